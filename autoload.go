@@ -0,0 +1,254 @@
+package gotcl
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// An AutoLoader supplies the command name for i the first time a
+// script calls it, returning nil if it doesn't know of one.
+type AutoLoader func(i *Interp, name string) (TclCmd, error)
+
+// AddAutoLoader has auto_load ask fn for missing commands, before it
+// looks in the tclIndex files along auto_path.
+func (i *Interp) AddAutoLoader(fn AutoLoader) {
+	i.autoLoaders = append(i.autoLoaders, fn)
+}
+
+// autoLoad defines the command name if it can, and reports whether
+// it's defined afterwards.
+func (i *Interp) autoLoad(name string) (bool, TclStatus) {
+	if i.autoPending[name] {
+		return false, kTclOK
+	}
+	if i.autoPending == nil {
+		i.autoPending = make(map[string]bool)
+	}
+	i.autoPending[name] = true
+	defer delete(i.autoPending, name)
+
+	for _, fn := range i.autoLoaders {
+		cmd, e := fn(i, name)
+		if e != nil {
+			return false, i.Fail(e)
+		}
+		if cmd != nil {
+			i.SetCmd(name, cmd)
+		}
+		if _, ok := i.cmds[name]; ok {
+			return true, kTclOK
+		}
+	}
+	if rc := i.loadIndex(); rc != kTclOK {
+		return false, rc
+	}
+	script, e := i.getVar(varRef{name: "auto_index", is_global: true, arrind: newLiteral(name)})
+	if e != nil {
+		return false, kTclOK
+	}
+	saved := i.frame
+	i.frame = i.varFrame(true)
+	rc := i.EvalObj(script)
+	i.frame = saved
+	if rc != kTclOK && rc != kTclReturn {
+		return false, rc
+	}
+	_, ok := i.cmds[name]
+	return ok, kTclOK
+}
+
+// loadIndex sources the tclIndex files in the directories on auto_path
+// into auto_index, if it hasn't since auto_path last changed. Each runs
+// with dir set to its directory. Earlier directories take precedence.
+func (i *Interp) loadIndex() TclStatus {
+	if i.safe {
+		return kTclOK
+	}
+	path, e := i.getVar(toVarRef("::auto_path"))
+	if e != nil {
+		return kTclOK
+	}
+	if old, e := i.getVar(toVarRef("::auto_oldpath")); e == nil && old.AsString() == path.AsString() {
+		return kTclOK
+	}
+	dirs, e := path.AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	i.setVar(toVarRef("::auto_oldpath"), path)
+	for ix := len(dirs) - 1; ix >= 0; ix-- {
+		fname := joinName(dirs[ix].AsString(), "tclIndex")
+		if _, rc := i.sourceInDir(fname, dirs[ix], "auto_index"); rc != kTclOK {
+			return rc
+		}
+	}
+	return kTclOK
+}
+
+// sourceInDir evaluates the file fname in a frame of its own, with dir
+// set to dir and the global variables named by globals linked in. It
+// reports whether fname could be opened.
+func (i *Interp) sourceInDir(fname string, dir *TclObj, globals ...string) (bool, TclStatus) {
+	file, e := i.FS().Open(fname)
+	if e != nil {
+		return false, kTclOK
+	}
+	cmds, pe := i.parseFile(fname, file)
+	file.Close()
+	if pe != nil {
+		return true, i.FailStr(fname + ": " + pe.Error())
+	}
+	global := i.varFrame(true)
+	f := newstackframe(global)
+	f.create("dir").obj = dir
+	for _, g := range globals {
+		f.create(g).link = &framelink{global, g}
+	}
+	saved := i.frame
+	i.frame = f
+	rc := i.evalCmds(cmds)
+	i.frame = saved
+	if rc == kTclReturn {
+		rc = kTclOK
+	}
+	return true, rc
+}
+
+// tclUnknown is called with the words of a command that doesn't exist,
+// and calls it if auto_load can define it.
+func tclUnknown(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"unknown cmdName ?arg ...?\"")
+	}
+	name := args[0].AsString()
+	ok, rc := i.autoLoad(name)
+	if rc != kTclOK {
+		return rc
+	}
+	if f, found := i.cmds[name]; ok && found {
+		return f(i, args[1:])
+	}
+	return i.FailStr("command not found: " + name)
+}
+
+func tclAutoLoad(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"auto_load cmdName\"")
+	}
+	ok, rc := i.autoLoad(args[0].AsString())
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(FromBool(ok))
+}
+
+// tclAutoReset forgets the index, so it's read again, and deletes the
+// procs it lists, so they're loaded again from their files.
+func tclAutoReset(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 0 {
+		return i.FailStr("wrong # args: should be \"auto_reset\"")
+	}
+	if v, e := i.lookupVar(toVarRef("::auto_index")); e == nil && v.arrdata != nil {
+		for name := range v.arrdata {
+			if ci, ok := i.cmdinfo[name]; ok && ci.proc != nil {
+				i.SetCmd(name, nil)
+			}
+		}
+	}
+	i.setVar(toVarRef("::auto_index"), nil)
+	i.setVar(toVarRef("::auto_oldpath"), nil)
+	return i.Return(kNil)
+}
+
+const indexHeader = `# Tcl autoload index file, version 2.0
+# This file is generated by the "auto_mkindex" command
+# and sourced to set up indexing information for one or
+# more commands.  Typically each line is a command that
+# sets an element in the auto_index array, where the
+# element name is the name of a command and the value is
+# a script that loads the command.
+
+`
+
+// tclAutoMkindex writes a tclIndex for the files in a directory,
+// listing the procs each defines at top level.
+func tclAutoMkindex(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"auto_mkindex dir ?pattern ...?\"")
+	}
+	dir := args[0].AsString()
+	pats := []string{"*.tcl"}
+	if len(args) > 1 {
+		pats = pats[:0]
+		for _, a := range args[1:] {
+			pats = append(pats, a.AsString())
+		}
+	}
+	ents, e := i.FS().ReadDir(dir)
+	if e != nil {
+		return i.Fail(e)
+	}
+	var b strings.Builder
+	b.WriteString(indexHeader)
+	for _, ent := range ents {
+		if ent.IsDir() || !globMatchAny(pats, ent.Name()) {
+			continue
+		}
+		procs, e := procsIn(i.FS(), joinName(dir, ent.Name()))
+		if e != nil {
+			return i.FailStr(ent.Name() + ": " + e.Error())
+		}
+		for _, p := range procs {
+			b.WriteString("set " + quoteElem("auto_index("+p+")") +
+				" [list source \"$dir/" + escapeString(ent.Name()) + "\"]\n")
+		}
+	}
+	w, e := i.FS().Create(joinName(dir, "tclIndex"))
+	if e == nil {
+		_, e = io.WriteString(w, b.String())
+		if ce := w.Close(); e == nil {
+			e = ce
+		}
+	}
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(kNil)
+}
+
+func globMatchAny(pats []string, s string) bool {
+	for _, p := range pats {
+		if GlobMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// procsIn returns the names of the procs fname defines at top level.
+func procsIn(fsys VFS, fname string) ([]string, error) {
+	file, e := fsys.Open(fname)
+	if e != nil {
+		return nil, e
+	}
+	defer file.Close()
+	cmds, e := parseCommands(bufio.NewReader(file))
+	if e != nil {
+		return nil, e
+	}
+	var procs []string
+	for _, c := range cmds {
+		if c.simple != nil && c.simple.cmdname == "proc" && len(c.simple.args) == 3 {
+			procs = append(procs, c.simple.args[0].AsString())
+		}
+	}
+	return procs, nil
+}
+
+func init() {
+	RegisterDefaultCmd("unknown", tclUnknown)
+	RegisterDefaultCmd("auto_load", tclAutoLoad)
+	RegisterDefaultCmd("auto_reset", tclAutoReset)
+	RegisterDefaultCmd("auto_mkindex", tclAutoMkindex)
+}
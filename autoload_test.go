@@ -0,0 +1,58 @@
+package gotcl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"math.tcl":      "proc double {x} { return [* $x 2] }\nproc quad {x} { return [double [double $x]] }\n",
+		"odd name.tcl":  "set ::loaded yes\nproc {odd one} {} { return odd }\n",
+		"notes.txt":     "proc ignored {} {}\n",
+		"recursive.tcl": "proc self {} { return [self] }\n",
+	}
+	for name, body := range files {
+		if e := os.WriteFile(filepath.Join(dir, name), []byte(body), 0666); e != nil {
+			t.Fatal(e)
+		}
+	}
+	i := NewInterp()
+	i.SetVarRaw("d", FromStr(dir))
+	if _, e := i.EvalString("auto_mkindex $d"); e != nil {
+		t.Fatal(e)
+	}
+	checkScripts(t, i, []scriptTest{
+		{"quad 3", "command not found: quad"},
+		{"set auto_path [list $d]\nquad 3", "12"},
+		{"info exists loaded", "0"},
+		{"auto_load {odd one}", "1"},
+		{"list $loaded [{odd one}]", "yes odd"},
+		{"auto_load ignored", "0"},
+		{"proc double {x} { return 0 }\nquad 5", "0"},
+		{"auto_reset\nquad 5", "20"},
+		{"set auto_index(self) self\nauto_load self", "command not found: self"},
+	})
+}
+
+func TestAutoLoader(t *testing.T) {
+	i := NewInterp()
+	asked := 0
+	i.AddAutoLoader(func(i *Interp, name string) (TclCmd, error) {
+		asked++
+		if name != "lazy" {
+			return nil, nil
+		}
+		return func(i *Interp, args []*TclObj) TclStatus {
+			return i.Return(FromStr("loaded"))
+		}, nil
+	})
+	if v, e := i.EvalString("list [lazy] [lazy] [auto_load other]"); e != nil || v.AsString() != "loaded loaded 0" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if asked != 2 {
+		t.Fatalf("asked %d times", asked)
+	}
+}
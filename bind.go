@@ -0,0 +1,406 @@
+package gotcl
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	tclObjType = reflect.TypeOf((*TclObj)(nil))
+	interpType = reflect.TypeOf((*Interp)(nil))
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// An argConv converts a command argument to a Go value.
+type argConv func(obj *TclObj) (reflect.Value, error)
+
+// A resultConv converts a Go value to a command result.
+type resultConv func(v reflect.Value) *TclObj
+
+func argConverter(t reflect.Type) (argConv, error) {
+	if t == tclObjType {
+		return func(obj *TclObj) (reflect.Value, error) {
+			return reflect.ValueOf(obj), nil
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(obj *TclObj) (reflect.Value, error) {
+			return reflect.ValueOf(obj.AsString()).Convert(t), nil
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(obj *TclObj) (reflect.Value, error) {
+			n, e := obj.AsInt64()
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(n) {
+				return v, errors.New("integer value too large to represent")
+			}
+			v.SetInt(n)
+			return v, nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(obj *TclObj) (reflect.Value, error) {
+			n, e := obj.AsInt64()
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			v := reflect.New(t).Elem()
+			if n < 0 {
+				return v, errors.New("expected unsigned integer but got \"" + obj.AsString() + "\"")
+			}
+			if v.OverflowUint(uint64(n)) {
+				return v, errors.New("integer value too large to represent")
+			}
+			v.SetUint(uint64(n))
+			return v, nil
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		return func(obj *TclObj) (reflect.Value, error) {
+			f, e := obj.AsFloat()
+			return reflect.ValueOf(f).Convert(t), e
+		}, nil
+	case reflect.Bool:
+		return func(obj *TclObj) (reflect.Value, error) {
+			b, e := obj.asBoolStrict()
+			return reflect.ValueOf(b).Convert(t), e
+		}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(obj *TclObj) (reflect.Value, error) {
+				return reflect.ValueOf(obj.AsBytes()).Convert(t), nil
+			}, nil
+		}
+		elem, e := argConverter(t.Elem())
+		if e != nil {
+			return nil, e
+		}
+		return func(obj *TclObj) (reflect.Value, error) {
+			l, e := obj.AsList()
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			v := reflect.MakeSlice(t, len(l), len(l))
+			for ix, item := range l {
+				ev, e := elem(item)
+				if e != nil {
+					return v, e
+				}
+				v.Index(ix).Set(ev)
+			}
+			return v, nil
+		}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		key, _ := argConverter(t.Key())
+		elem, e := argConverter(t.Elem())
+		if e != nil {
+			return nil, e
+		}
+		return func(obj *TclObj) (reflect.Value, error) {
+			l, e := obj.AsList()
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			if len(l)%2 != 0 {
+				return reflect.Value{}, errors.New("missing value to go with key")
+			}
+			v := reflect.MakeMapWithSize(t, len(l)/2)
+			for ix := 0; ix < len(l); ix += 2 {
+				kv, _ := key(l[ix])
+				ev, e := elem(l[ix+1])
+				if e != nil {
+					return v, e
+				}
+				v.SetMapIndex(kv, ev)
+			}
+			return v, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("can't convert arguments to %v", t)
+}
+
+func resultConverter(t reflect.Type) (resultConv, error) {
+	if t == tclObjType {
+		return func(v reflect.Value) *TclObj {
+			if v.IsNil() {
+				return kNil
+			}
+			return v.Interface().(*TclObj)
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(v reflect.Value) *TclObj { return FromStr(v.String()) }, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) *TclObj { return FromInt64(v.Int()) }, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) *TclObj {
+			return FromStr(strconv.FormatUint(v.Uint(), 10))
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value) *TclObj { return FromFloat(v.Float()) }, nil
+	case reflect.Bool:
+		return func(v reflect.Value) *TclObj { return FromBool(v.Bool()) }, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return func(v reflect.Value) *TclObj { return FromBytes(v.Bytes()) }, nil
+		}
+		elem, e := resultConverter(t.Elem())
+		if e != nil {
+			return nil, e
+		}
+		return func(v reflect.Value) *TclObj {
+			l := make([]*TclObj, v.Len())
+			for ix := range l {
+				l[ix] = elem(v.Index(ix))
+			}
+			return fromList(l)
+		}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		elem, e := resultConverter(t.Elem())
+		if e != nil {
+			return nil, e
+		}
+		return func(v reflect.Value) *TclObj {
+			keys := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			l := make([]*TclObj, 0, 2*len(keys))
+			for _, k := range keys {
+				kv := reflect.ValueOf(k).Convert(t.Key())
+				l = append(l, FromStr(k), elem(v.MapIndex(kv)))
+			}
+			return fromList(l)
+		}, nil
+	}
+	return nil, fmt.Errorf("can't convert results from %v", t)
+}
+
+// typeName describes t in usage messages when a parameter isn't named.
+func typeName(t reflect.Type) string {
+	if t == tclObjType {
+		return "value"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "list"
+	case reflect.Map:
+		return "dict"
+	}
+	return t.Kind().String()
+}
+
+type binding struct {
+	fn       reflect.Value
+	params   []argConv // nil where the *Interp goes
+	rest     argConv   // for a variadic tail
+	nargs    int
+	results  []resultConv
+	hasError bool
+	name     string
+	words    string // the arguments, for the usage message
+}
+
+// BindFunc wraps the Go function fn as a command, converting its
+// arguments and results by reflection. Parameters may be strings,
+// integers, floats, bools, *TclObj, or slices or string-keyed maps of
+// those, which are taken from lists; a *Interp parameter gets the
+// calling interp rather than an argument. If the last result is an
+// error, a non-nil one fails the command; any other results make up
+// its value, as a list if there's more than one.
+//
+// name and params, the names of the parameters other than *Interp,
+// are used to describe the arguments when too few or too many are
+// given. Type names are used for params not named, and the word the
+// command was invoked by if name is empty. A panic in fn fails the
+// command with the value it panicked with.
+func BindFunc(name string, fn interface{}, params ...string) (TclCmd, error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("can't bind %v: not a function", ft)
+	}
+	b := &binding{fn: fv, name: name}
+	var words []string
+	for ix := 0; ix < ft.NumIn(); ix++ {
+		t := ft.In(ix)
+		if t == interpType {
+			b.params = append(b.params, nil)
+			continue
+		}
+		variadic := ft.IsVariadic() && ix == ft.NumIn()-1
+		if variadic {
+			t = t.Elem()
+		}
+		conv, e := argConverter(t)
+		if e != nil {
+			return nil, e
+		}
+		pname := typeName(t)
+		if n := b.nargs; n < len(params) {
+			pname = params[n]
+		}
+		if variadic {
+			b.rest = conv
+			words = append(words, "?"+pname+" ...?")
+		} else {
+			b.params = append(b.params, conv)
+			b.nargs++
+			words = append(words, pname)
+		}
+	}
+	nout := ft.NumOut()
+	if nout > 0 && ft.Out(nout-1) == errorType {
+		b.hasError = true
+		nout--
+	}
+	for ix := 0; ix < nout; ix++ {
+		conv, e := resultConverter(ft.Out(ix))
+		if e != nil {
+			return nil, e
+		}
+		b.results = append(b.results, conv)
+	}
+	b.words = strings.Join(words, " ")
+	return b.call, nil
+}
+
+func (b *binding) usage(i *Interp) string {
+	words := b.name
+	if words == "" {
+		words = i.cmdname
+	}
+	if b.words != "" {
+		words += " " + b.words
+	}
+	return "wrong # args: should be \"" + words + "\""
+}
+
+func (b *binding) call(i *Interp, args []*TclObj) (rc TclStatus) {
+	if len(args) < b.nargs || (b.rest == nil && len(args) > b.nargs) {
+		return i.FailStr(b.usage(i))
+	}
+	in := make([]reflect.Value, 0, len(b.params)+len(args)-b.nargs)
+	for _, conv := range b.params {
+		if conv == nil {
+			in = append(in, reflect.ValueOf(i))
+			continue
+		}
+		v, e := conv(args[0])
+		if e != nil {
+			return i.Fail(e)
+		}
+		in = append(in, v)
+		args = args[1:]
+	}
+	for _, a := range args {
+		v, e := b.rest(a)
+		if e != nil {
+			return i.Fail(e)
+		}
+		in = append(in, v)
+	}
+	frame, depth := i.frame, len(i.stack)
+	defer func() {
+		if p := recover(); p != nil {
+			i.frame = frame
+			clear(i.stack[depth:])
+			i.stack = i.stack[:depth]
+			rc = i.FailStr(fmt.Sprint(p))
+		}
+	}()
+	out := b.fn.Call(in)
+	if b.hasError {
+		if e := out[len(out)-1]; !e.IsNil() {
+			return i.Fail(e.Interface().(error))
+		}
+	}
+	switch len(b.results) {
+	case 0:
+		return i.Return(kNil)
+	case 1:
+		return i.Return(b.results[0](out[0]))
+	}
+	l := make([]*TclObj, len(b.results))
+	for ix, conv := range b.results {
+		l[ix] = conv(out[ix])
+	}
+	return i.Return(fromList(l))
+}
+
+// Bind makes fn the command name, as wrapped by BindFunc.
+func (i *Interp) Bind(name string, fn interface{}, params ...string) error {
+	cmd, e := BindFunc(name, fn, params...)
+	if e != nil {
+		return e
+	}
+	i.SetCmd(name, cmd)
+	return nil
+}
+
+func mustBind(name string, fn interface{}, params []string) TclCmd {
+	cmd, e := BindFunc(name, fn, params...)
+	if e != nil {
+		panic(e)
+	}
+	return cmd
+}
+
+// Func0 to Func3 are BindFunc for functions whose shape is checked when
+// the program is compiled. They panic if a type can't be converted.
+// Func0NoErr to Func3NoErr are the same for functions that can't fail.
+func Func0[R any](name string, fn func() (R, error)) TclCmd {
+	return mustBind(name, fn, nil)
+}
+
+func Func1[A, R any](name string, fn func(A) (R, error), params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
+
+func Func2[A, B, R any](name string, fn func(A, B) (R, error), params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
+
+func Func3[A, B, C, R any](name string, fn func(A, B, C) (R, error), params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
+
+func Func0NoErr[R any](name string, fn func() R) TclCmd {
+	return mustBind(name, fn, nil)
+}
+
+func Func1NoErr[A, R any](name string, fn func(A) R, params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
+
+func Func2NoErr[A, B, R any](name string, fn func(A, B) R, params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
+
+func Func3NoErr[A, B, C, R any](name string, fn func(A, B, C) R, params ...string) TclCmd {
+	return mustBind(name, fn, params)
+}
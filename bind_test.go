@@ -0,0 +1,109 @@
+package gotcl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBindFunc(t *testing.T) {
+	i := NewInterp()
+	bind := func(name string, fn interface{}, params ...string) {
+		if e := i.Bind(name, fn, params...); e != nil {
+			t.Fatal(e)
+		}
+	}
+	bind("add", func(a int64, b uint) int64 { return a + int64(b) }, "a", "b")
+	bind("half", func(f float64) float64 { return f / 2 })
+	bind("sum", func(base int, rest ...int) int {
+		for _, n := range rest {
+			base += n
+		}
+		return base
+	}, "base", "n")
+	bind("join", func(l []string, sep string) string { return strings.Join(l, sep) })
+	bind("keys", func(m map[string]int) []string {
+		var ks []string
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks
+	})
+	bind("divmod", func(a, b int) (int, int, error) {
+		if b == 0 {
+			return 0, 0, errors.New("divide by zero")
+		}
+		return a / b, a % b, nil
+	})
+	bind("not", func(b bool) bool { return !b })
+	bind("level", func(i *Interp, o *TclObj) string { return o.AsString() + "!" })
+
+	for _, c := range []struct{ script, want string }{
+		{"add 2 3", "5"},
+		{"half 3", "1.5"},
+		{"half 4", "2.0"},
+		{"sum 1", "1"},
+		{"sum 1 2 3", "6"},
+		{"join {a b c} -", "a-b-c"},
+		{"keys {x 1}", "x"},
+		{"divmod 7 2", "3 1"},
+		{"not yes", "0"},
+		{"level hi", "hi!"},
+	} {
+		v, e := i.EvalString(c.script)
+		if e != nil || v.AsString() != c.want {
+			t.Errorf("%s: got %v, %v; want %s", c.script, v, e, c.want)
+		}
+	}
+	for _, c := range []struct{ script, want string }{
+		{"add 1", `wrong # args: should be "add a b"`},
+		{"sum", `wrong # args: should be "sum base ?n ...?"`},
+		{"half 1 2", `wrong # args: should be "half double"`},
+		{"add 1 -1", `expected unsigned integer but got "-1"`},
+		{"half x", `expected floating-point number but got "x"`},
+		{"divmod 1 0", "divide by zero"},
+		{"keys {x}", "missing value to go with key"},
+	} {
+		_, e := i.EvalString(c.script)
+		if e == nil || e.Error() != c.want {
+			t.Errorf("%s: got error %v; want %s", c.script, e, c.want)
+		}
+	}
+	if e := i.Bind("bad", 3); e == nil {
+		t.Error("bound a non-function")
+	}
+	if e := i.Bind("bad", func(c chan int) {}); e == nil {
+		t.Error("bound a function taking a channel")
+	}
+}
+
+func TestFuncGeneric(t *testing.T) {
+	i := NewInterp()
+	i.SetCmd("repeat", Func2("repeat", func(s string, n int) (string, error) {
+		return strings.Repeat(s, n), nil
+	}, "string", "count"))
+	v, e := i.EvalString("repeat ab 3")
+	if e != nil || v.AsString() != "ababab" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if _, e := i.EvalString("repeat ab"); e == nil || e.Error() != `wrong # args: should be "repeat string count"` {
+		t.Fatalf("got %v", e)
+	}
+}
+
+func TestBindUsageAndPanics(t *testing.T) {
+	i := NewInterp()
+	i.SetCmd("rep", MakeCmd(func(s string, n int) string { return strings.Repeat(s, n) }))
+	i.SetCmd("nth", Func2NoErr("", func(l []string, n int) string { return l[n] }))
+	i.SetCmd("twice", Func1NoErr("twice", func(n int) int { return 2 * n }, "n"))
+	checkScripts(t, i, []scriptTest{
+		{"rep ab", `wrong # args: should be "rep string integer"`},
+		{"rename rep again\nagain ab", `wrong # args: should be "again string integer"`},
+		{"nth {a b} 5", "runtime error: index out of range [5] with length 2"},
+		{"twice", `wrong # args: should be "twice n"`},
+	})
+	v, e := i.EvalString("list [catch {nth {a} 1} msg] [nth {a b} 1] [twice 4]")
+	if e != nil || v.AsString() != "1 b 8" {
+		t.Errorf("got %v, %v", v, e)
+	}
+}
@@ -69,7 +69,12 @@ func tclRecvChan(i *Interp, args []*TclObj) TclStatus {
 	if ch == nil {
 		return i.FailStr("not a chan: " + name)
 	}
-	v := <-ch
+	var v *TclObj
+	select {
+	case v = <-ch:
+	case <-i.done():
+		return i.cancelled()
+	}
 	if v == nil {
 		v = kNil
 	}
@@ -85,15 +90,45 @@ func tclSendChan(i *Interp, args []*TclObj) TclStatus {
 	if ch == nil {
 		return i.FailStr("not a chan: " + name)
 	}
-	ch <- args[1]
+	select {
+	case ch <- args[1]:
+	case <-i.done():
+		return i.cancelled()
+	}
 	return i.Return(kNil)
 }
 
-func tclGo(i *Interp, args []*TclObj) TclStatus {
+// goInterp returns an interp for running code from i in another
+// goroutine. It starts with i's commands, sharing the table until
+// either of them changes it, and copies of i's other state.
+func (i *Interp) goInterp() *Interp {
 	ni := new(Interp)
 	ni.cmds = i.cmds
-	ni.chans = i.chans
+	ni.cmdsShared.Store(true)
+	i.cmdsShared.Store(true)
+	ni.epoch = i.epoch
 	ni.frame = newstackframe(nil)
+	ni.chans = make(map[string]interface{}, len(i.chans))
+	for n, c := range i.chans {
+		ni.chans[n] = c
+	}
+	if i.hidden != nil {
+		ni.hidden = make(map[string]TclCmd, len(i.hidden))
+		for n, c := range i.hidden {
+			ni.hidden[n] = c
+		}
+	}
+	ni.safe = i.safe
+	ni.vfs = i.vfs
+	ni.replaced = i.replaced
+	ni.autoLoaders = i.autoLoaders[:len(i.autoLoaders):len(i.autoLoaders)]
+	ni.copyPkgs(i)
+	ni.limits = i.limits.inherit()
+	return ni
+}
+
+func tclGo(i *Interp, args []*TclObj) TclStatus {
+	ni := i.goInterp()
 	go func() {
 		tclEval(ni, args)
 		if ni.err != nil {
@@ -113,7 +148,20 @@ func tclForChan(i *Interp, args []*TclObj) TclStatus {
 	if ch == nil {
 		return i.FailStr("not a chan: " + name)
 	}
-	for v := range ch {
+	for {
+		var v *TclObj
+		ok := true
+		select {
+		case v, ok = <-ch:
+		case <-i.done():
+			return i.cancelled()
+		}
+		if !ok {
+			break
+		}
+		if i.limits != nil && i.checkLimits(false) != kTclOK {
+			return kTclErr
+		}
 		i.setVar(vname, v)
 		rc := i.EvalObj(args[2])
 		if rc == kTclBreak {
@@ -0,0 +1,42 @@
+package gotcl
+
+import (
+	"testing"
+)
+
+// Run with -race: goroutines share procs, literals and small ints
+// with the interp that started them while it keeps defining procs.
+func TestGoShared(t *testing.T) {
+	i := NewInterp()
+	v, e := i.EvalString(`
+set results [newchan]
+set nums [list 1 2 3 4 5]
+proc work {n lst ch} {
+    proc helper {} { return 1 }
+    set sum 0
+    foreach x $lst {
+        incr sum [expr {$x * [helper]}]
+    }
+    sendchan $ch $sum
+}
+for {set n 0} {$n < 8} {incr n} {
+    go [list work $n $nums $results]
+}
+set total 0
+for {set n 0} {$n < 8} {incr n} {
+    proc other {} {}
+    llength $nums
+    incr total [<- $results]
+}
+set total
+`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v.AsString() != "120" {
+		t.Fatalf("expected 120, got %s", v.AsString())
+	}
+	if _, e := i.EvalString("helper"); e == nil {
+		t.Fatal("proc defined in goroutine leaked into parent")
+	}
+}
@@ -0,0 +1,119 @@
+package gotcl
+
+import "sync"
+
+// Clone returns a new interp with the same commands, procs, channels
+// and global variables as i. Nothing is deep-copied up front: the
+// command table is shared until either interp changes it, and values
+// are immutable, so the clone is cheap to make and changes to it never
+// show in i, or the other way round. Child interps and limits aren't
+// cloned, so neither are aliases to commands in other interps: only
+// aliases to i's own commands are kept, calling the clone's instead.
+//
+// Cloning only reads i, apart from marking its command table shared,
+// which is done atomically, so several goroutines can clone the same
+// interp at once, as long as none of them changes it.
+func (i *Interp) Clone() *Interp {
+	ni := new(Interp)
+	ni.copyFrom(i)
+	return ni
+}
+
+// copyFrom resets i to a clone of src, deleting everything i had.
+func (i *Interp) copyFrom(src *Interp) {
+	for _, c := range i.children {
+		c.delete()
+	}
+	for _, ci := range i.cmdinfo {
+		if ci.deleter != nil {
+			ci.deleter()
+		}
+	}
+	if !src.cmdsShared.Load() {
+		src.cmdsShared.Store(true)
+	}
+	*i = Interp{
+		cmds:       src.cmds,
+		epoch:      src.epoch,
+		replaced:   src.replaced,
+		safe:       src.safe,
+		vfs:        src.vfs,
+		chans:      make(map[string]interface{}, len(src.chans)),
+		frame:      cloneGlobals(src.varFrame(true)),
+		stack:      i.stack[:0],
+		freeFrames: i.freeFrames,
+	}
+	i.cmdsShared.Store(true)
+	i.autoLoaders = src.autoLoaders[:len(src.autoLoaders):len(src.autoLoaders)]
+	i.copyPkgs(src)
+	for n, c := range src.chans {
+		i.chans[n] = c
+	}
+	if src.hidden != nil {
+		i.hidden = make(map[string]TclCmd, len(src.hidden))
+		for n, c := range src.hidden {
+			i.hidden[n] = c
+		}
+	}
+	for n, a := range src.aliases {
+		if a.target != src {
+			i.SetCmd(n, nil)
+			continue
+		}
+		i.Alias(n, i, a.cmdline[0].AsString(), a.cmdline[1:]...)
+	}
+	for name, ci := range src.cmdinfo {
+		if ci.proc != nil || ci.origin != "" {
+			nci := i.info(name)
+			nci.proc, nci.origin = ci.proc, ci.origin
+		}
+	}
+}
+
+func cloneGlobals(g *stackframe) *stackframe {
+	ng := newstackframe(nil)
+	for name, v := range g.vars {
+		nv := *v
+		if nv.arrdata != nil {
+			nv.arrdata = make(map[string]*TclObj, len(v.arrdata))
+			for k, obj := range v.arrdata {
+				nv.arrdata[k] = obj
+			}
+		}
+		if nv.link != nil && nv.link.frame == g {
+			nv.link = &framelink{ng, nv.link.name}
+		}
+		*ng.create(name) = nv
+	}
+	return ng
+}
+
+// A Pool hands out clones of an interp, such as one that has had its
+// commands registered and library code sourced, for work that needs
+// an interp of its own. The interp mustn't be changed once it's in a
+// pool.
+type Pool struct {
+	proto *Interp
+	free  sync.Pool
+}
+
+func NewPool(proto *Interp) *Pool {
+	proto.cmdsShared.Store(true)
+	return &Pool{proto: proto}
+}
+
+// Get returns a clone of the pool's interp, reusing one put back
+// earlier if there is one.
+func (p *Pool) Get() *Interp {
+	if i, ok := p.free.Get().(*Interp); ok {
+		return i
+	}
+	return p.proto.Clone()
+}
+
+// Put resets i, which must have come from Get, to a fresh clone and
+// keeps it for reuse.
+func (p *Pool) Put(i *Interp) {
+	i.copyFrom(p.proto)
+	p.free.Put(i)
+}
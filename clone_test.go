@@ -0,0 +1,102 @@
+package gotcl
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const cloneSetup = `
+proc add {a b} { return [+ $a $b] }
+set x 1
+array set arr {k 4}
+`
+
+func cloneProto() *Interp {
+	i := NewInterp()
+	RunString(i, cloneSetup)
+	return i
+}
+
+func TestClone(t *testing.T) {
+	i := cloneProto()
+	c := i.Clone()
+	if v, e := c.EvalString("add $x 2"); e != nil || v.AsString() != "3" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	script := `
+set x 2
+set arr(k) 5
+set y new
+proc add {a b} { return [- $a $b] }
+rename set assign
+add $x $arr(k)
+`
+	if v, e := c.EvalString(script); e != nil || v.AsString() != "-3" {
+		t.Fatalf("clone: got %v, %v", v, e)
+	}
+	if v, e := i.EvalString("list [add $x $arr(k)] [info exists y] [info commands assign]"); e != nil || v.AsString() != "5 0 {}" {
+		t.Fatalf("original: got %v, %v", v, e)
+	}
+	if v, e := i.Clone().EvalString("add $x 2"); e != nil || v.AsString() != "3" {
+		t.Fatalf("second clone: got %v, %v", v, e)
+	}
+}
+
+func TestCloneAliases(t *testing.T) {
+	i := cloneProto()
+	RunString(i, "interp alias {} sum {} add 10\ninterp create kid\ninterp alias {} inkid kid set")
+	c := i.Clone()
+	RunString(c, "proc add {a b} { return [- $a $b] }")
+	if v, e := c.EvalString("list [sum 3] [info commands inkid]"); e != nil || v.AsString() != "7 {}" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if v, e := i.EvalString("list [sum 3] [inkid y 1]"); e != nil || v.AsString() != "13 1" {
+		t.Fatalf("original: got %v, %v", v, e)
+	}
+}
+
+func TestCloneConcurrently(t *testing.T) {
+	i := cloneProto()
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := i.Clone()
+			if v, e := c.EvalString("proc add {a b} { return \"$a:$b\" }\nadd $x 2"); e != nil || v.AsString() != "1:2" {
+				t.Errorf("got %v, %v", v, e)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPool(t *testing.T) {
+	p := NewPool(cloneProto())
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for k := 0; k < 50; k++ {
+				i := p.Get()
+				s := strconv.Itoa(n)
+				v, e := i.EvalString("incr x " + s + "\nproc add {a b} {return \"$a:$b\"}\nadd $x $arr(k)")
+				if want := strconv.Itoa(1+n) + ":4"; e != nil || v.AsString() != want {
+					t.Errorf("got %v, %v, want %v", v, e, want)
+				}
+				p.Put(i)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func Benchmark_Clone(b *testing.B) {
+	i := cloneProto()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.Clone()
+	}
+}
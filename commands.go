@@ -3,10 +3,12 @@ package gotcl
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode"
 	"unicode/utf8"
@@ -46,25 +48,19 @@ func tclUplevel(i *Interp, args []*TclObj) TclStatus {
 	return rc
 }
 
+var uniqueNum int64
+
 // getUniqueNum returns a unique integer.
-// It is not threadsafe, and it uses a function
-// literal to keep the current value scope hidden.
-// It's a bit too tricky.
-var getUniqueNum = func() func() int {
-	uniqueNum := 0
-	return func() int {
-		v := uniqueNum
-		uniqueNum++
-		return v
-	}
-}()
+func getUniqueNum() int {
+	return int(atomic.AddInt64(&uniqueNum, 1) - 1)
+}
 
 func tclOpen(i *Interp, args []*TclObj) TclStatus {
 	if len(args) != 1 {
 		return i.FailStr("wrong # args")
 	}
 	fname := args[0].AsString()
-	ff, err := os.Open(fname)
+	ff, err := i.FS().Open(fname)
 	if err != nil {
 		return i.Fail(err)
 	}
@@ -147,6 +143,9 @@ func tclCatch(i *Interp, args []*TclObj) TclStatus {
 		return i.FailStr("wrong # args to catch")
 	}
 	r := i.EvalObj(args[0])
+	if r == kTclErr && i.limitExceeded() {
+		return r
+	}
 	if len(args) == 2 {
 		val := kNil
 		if r == kTclErr {
@@ -160,41 +159,62 @@ func tclCatch(i *Interp, args []*TclObj) TclStatus {
 	return i.Return(FromInt(int(r)))
 }
 
-func tclIf(i *Interp, args []*TclObj) TclStatus {
-	if len(args) < 2 {
-		return i.FailStr("wrong # args")
+// ifClauses splits the arguments of if into the conditions and the
+// bodies they guard, plus the else body if there is one.
+func ifClauses(args []*TclObj) (conds, bodies []*TclObj, elsebody *TclObj, err error) {
+	for {
+		if len(args) == 0 {
+			return nil, nil, nil, errors.New("wrong # args: no expression after \"if\" argument")
+		}
+		conds = append(conds, args[0])
+		args = args[1:]
+		if len(args) > 0 && args[0].AsString() == "then" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return nil, nil, nil, errors.New("wrong # args: no script following condition")
+		}
+		bodies = append(bodies, args[0])
+		args = args[1:]
+		if len(args) == 0 {
+			return
+		}
+		switch args[0].AsString() {
+		case "elseif":
+			args = args[1:]
+			continue
+		case "else":
+			args = args[1:]
+			if len(args) == 0 {
+				return nil, nil, nil, errors.New("wrong # args: no script following 'else' argument")
+			}
+		}
+		if len(args) > 1 {
+			return nil, nil, nil, errors.New("wrong # args: extra words after \"else\" clause in \"if\" command")
+		}
+		return conds, bodies, args[0], nil
 	}
-	cond, err := args[0].asExpr()
+}
+
+func tclIf(i *Interp, args []*TclObj) TclStatus {
+	conds, bodies, elsebody, err := ifClauses(args)
 	if err != nil {
 		return i.Fail(err)
 	}
-	args = args[1:]
-	if args[0].AsString() == "then" {
-		args = args[1:]
-	}
-	body := args[0]
-	args = args[1:]
-	var elseblock *TclObj
-	if len(args) > 0 {
-		if args[0].AsString() == "else" {
-			if len(args) == 1 {
-				return i.FailStr("wrong # args: no script following 'else' argument")
-			}
-			args = args[1:]
+	for ix, c := range conds {
+		cond, err := c.asExpr()
+		if err != nil {
+			return i.Fail(err)
+		}
+		if rc := cond.Eval(i); rc != kTclOK {
+			return rc
 		}
-		if len(args) > 0 {
-			elseblock = args[0]
+		if i.retval.AsBool() {
+			return i.EvalObj(bodies[ix])
 		}
 	}
-	rc := cond.Eval(i)
-	if rc != kTclOK {
-		return rc
-	}
-
-	if i.retval.AsBool() {
-		return i.EvalObj(body)
-	} else if elseblock != nil {
-		return i.EvalObj(elseblock)
+	if elsebody != nil {
+		return i.EvalObj(elsebody)
 	}
 	return i.Return(kNil)
 }
@@ -229,6 +249,9 @@ func tclWhile(i *Interp, args []*TclObj) TclStatus {
 	}
 	cond := i.retval.AsBool()
 	for cond {
+		if i.limits != nil && i.checkLimits(false) != kTclOK {
+			return kTclErr
+		}
 		rc = i.EvalObj(body)
 		if rc == kTclBreak {
 			break
@@ -264,6 +287,9 @@ func tclFor(i *Interp, args []*TclObj) TclStatus {
 
 	cond := i.retval.AsBool()
 	for cond {
+		if i.limits != nil && i.checkLimits(false) != kTclOK {
+			return kTclErr
+		}
 		rc = i.EvalObj(body)
 		if rc == kTclBreak {
 			break
@@ -282,46 +308,86 @@ func tclFor(i *Interp, args []*TclObj) TclStatus {
 	return i.Return(kNil)
 }
 
-func tclForeach(i *Interp, args []*TclObj) TclStatus {
-	if len(args) != 3 {
-		return i.FailStr("wrong # args: should be \"foreach varName list body\"")
-	}
-	list, err := args[1].AsList()
-	if err != nil {
-		return i.Fail(err)
-	}
-	body := args[2]
-	vlist, err := args[0].AsList()
-	if err != nil {
-		return i.Fail(err)
-	}
-	chunksz := len(vlist)
-	if chunksz == 0 {
-		return i.FailStr("foreach varlist is empty")
+// foreachLoop runs the body that ends args once for each set of values
+// taken from the lists in args, as foreach and lmap do, padding short
+// lists with empty strings. It calls collect with the result of each
+// run of the body that finishes normally.
+func foreachLoop(i *Interp, cmd string, args []*TclObj, collect func(*TclObj)) TclStatus {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return i.FailStr("wrong # args: should be \"" + cmd + " varList list ?varList list ...? command\"")
+	}
+	body := args[len(args)-1]
+	nlists := len(args) / 2
+	vlists := make([][]*TclObj, nlists)
+	lists := make([][]*TclObj, nlists)
+	iters := 0
+	for lx := range lists {
+		var err error
+		if vlists[lx], err = args[2*lx].AsList(); err != nil {
+			return i.Fail(err)
+		}
+		if len(vlists[lx]) == 0 {
+			return i.FailStr(cmd + " varlist is empty")
+		}
+		if lists[lx], err = args[2*lx+1].AsList(); err != nil {
+			return i.Fail(err)
+		}
+		chunksz := len(vlists[lx])
+		iters = max(iters, (len(lists[lx])+chunksz-1)/chunksz)
 	}
-	for len(list) > 0 {
-		for ind, vn := range vlist {
-			i.setVar(vn.asVarRef(), list[ind])
+	for it := 0; it < iters; it++ {
+		if i.limits != nil && i.checkLimits(false) != kTclOK {
+			return kTclErr
+		}
+		for lx, vlist := range vlists {
+			for vx, vn := range vlist {
+				val := kNil
+				if ix := it*len(vlist) + vx; ix < len(lists[lx]) {
+					val = lists[lx][ix]
+				}
+				if rc := i.setVar(vn.asVarRef(), val); rc != kTclOK {
+					return rc
+				}
+			}
 		}
-		list = list[chunksz:]
 		rc := i.EvalObj(body)
 		if rc == kTclBreak {
 			break
+		} else if rc == kTclOK && collect != nil {
+			collect(i.retval)
 		} else if rc != kTclOK && rc != kTclContinue {
 			return rc
 		}
+	}
+	return kTclOK
+}
 
+func tclForeach(i *Interp, args []*TclObj) TclStatus {
+	if rc := foreachLoop(i, "foreach", args, nil); rc != kTclOK {
+		return rc
 	}
 	return i.Return(kNil)
 }
 
+func tclLmap(i *Interp, args []*TclObj) TclStatus {
+	var res []*TclObj
+	rc := foreachLoop(i, "lmap", args, func(v *TclObj) {
+		res = append(res, v)
+	})
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(fromList(res))
+}
+
 func asInts(a *TclObj, b *TclObj) (ai int, bi int, e error) {
 	bi, e = b.AsInt()
 	ai, e = a.AsInt()
 	return
 }
 
-// Try to convert an arbitrary function to a TclCmd based on type.
+// Try to convert an arbitrary function to a TclCmd based on type,
+// falling back to BindFunc for signatures not handled here.
 // Panics on failure.
 func MakeCmd(fni interface{}) TclCmd {
 	switch fn := fni.(type) {
@@ -426,7 +492,11 @@ func MakeCmd(fni interface{}) TclCmd {
 			return i.Return(FromBool(fn(a, b)))
 		}
 	}
-	panic("Can't convert!")
+	cmd, e := BindFunc("", fni)
+	if e != nil {
+		panic(e)
+	}
+	return cmd
 }
 
 func tclLlength(i *Interp, args []*TclObj) TclStatus {
@@ -445,18 +515,29 @@ func tclList(i *Interp, args []*TclObj) TclStatus {
 }
 
 func tclLindex(i *Interp, args []*TclObj) TclStatus {
-	l, err := args[0].AsList()
-	if err != nil {
-		return i.Fail(err)
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"lindex list ?index ...?\"")
 	}
-	ind, err := args[1].AsInt()
+	path, err := indexPath(args[1:])
 	if err != nil {
-		i.Fail(err)
+		return i.Fail(err)
 	}
-	if ind >= len(l) {
-		i.FailStr("out of bounds")
+	v := args[0]
+	for _, x := range path {
+		l, err := v.AsList()
+		if err != nil {
+			return i.Fail(err)
+		}
+		ind, rc := i.getIndex(x, len(l))
+		if rc != kTclOK {
+			return rc
+		}
+		if ind < 0 || ind >= len(l) {
+			return i.Return(kNil)
+		}
+		v = l[ind]
 	}
-	return i.Return(l[ind])
+	return i.Return(v)
 }
 
 func concat(args []*TclObj) *TclObj {
@@ -491,18 +572,15 @@ func tclLappend(i *Interp, args []*TclObj) TclStatus {
 	vname := args[0].asVarRef()
 	v, ve := i.getVar(vname)
 	if ve != nil {
-		v = fromList(make([]*TclObj, 0, 10))
+		v = kNil
 	}
-	items, err := v.AsList()
+	newobj, err := v.appendList(args[1:])
 	if err != nil {
 		return i.Fail(err)
 	}
-	new_items := args[1:]
-	new_len := len(items) + len(new_items)
-	dest := make([]*TclObj, 0, new_len)
-	dest = append(append(dest, items...), new_items...)
-	newobj := fromList(dest)
-	i.setVar(vname, newobj)
+	if rc := i.setVar(vname, newobj); rc != kTclOK {
+		return rc
+	}
 	return i.Return(newobj)
 }
 
@@ -535,7 +613,10 @@ func tclTime(i *Interp, args []*TclObj) TclStatus {
 		}
 		total := int64(0)
 		for x := 0; x < count; x++ {
-			dur, _ := getDuration(i, args[0])
+			dur, rc := getDuration(i, args[0])
+			if rc == kTclErr && i.limitExceeded() {
+				return rc
+			}
 			total += dur
 		}
 		avg := total / int64(count)
@@ -563,7 +644,7 @@ func tclFlush(i *Interp, args []*TclObj) TclStatus {
 func tclPuts(i *Interp, args []*TclObj) TclStatus {
 	newline := true
 	var s string
-	file := i.chans["stdout"].(io.Writer)
+	chname := "stdout"
 	if len(args) == 1 {
 		s = args[0].AsString()
 	} else if len(args) == 2 || len(args) == 3 {
@@ -572,18 +653,19 @@ func tclPuts(i *Interp, args []*TclObj) TclStatus {
 			args = args[1:]
 		}
 		if len(args) > 1 {
-			outfile, ok := i.chans[args[0].AsString()]
-			if !ok {
-				return i.FailStr("wrong args")
-			}
-			file, ok = outfile.(io.Writer)
-			if !ok {
-				return i.FailStr("channel wasn't opened for writing")
-			}
+			chname = args[0].AsString()
 			args = args[1:]
 		}
 		s = args[0].AsString()
 	}
+	outfile, ok := i.chans[chname]
+	if !ok {
+		return i.FailStr("can not find channel named \"" + chname + "\"")
+	}
+	file, ok := outfile.(io.Writer)
+	if !ok {
+		return i.FailStr("channel wasn't opened for writing")
+	}
 	if newline {
 		fmt.Fprintln(file, s)
 	} else {
@@ -626,23 +708,17 @@ func tclGets(i *Interp, args []*TclObj) TclStatus {
 	return i.Return(FromStr(str))
 }
 
-func getVarNameList(m varMap) *TclObj {
-	results := make([]*TclObj, len(m))
-	ind := 0
-	for vn := range m {
-		results[ind] = FromStr(vn)
-		ind++
-	}
-	return fromList(results)
+func getVarNameList(f *stackframe) *TclObj {
+	return FromList(f.names())
 }
 
 var infoEn = ensembleSpec{
 	"exists": varExists,
 	"vars": func(i *Interp) *TclObj {
-		return getVarNameList(i.getVarMap(false))
+		return getVarNameList(i.varFrame(false))
 	},
 	"globals": func(i *Interp) *TclObj {
-		return getVarNameList(i.getVarMap(true))
+		return getVarNameList(i.varFrame(true))
 	},
 	"commands": getCmdNames,
 	"cmdcount": func(i *Interp) *TclObj {
@@ -696,21 +772,17 @@ var stringEn = ensembleSpec{
 
 func strIndex(i *Interp, args []*TclObj) TclStatus {
 	if len(args) != 2 {
-		return i.FailStr("wrong # args")
+		return i.FailStr("wrong # args: should be \"string index string charIndex\"")
 	}
-	str := args[0].AsString()
-	ind, e := args[1].AsInt()
-	if e != nil {
-		if args[1].AsString() == "end" {
-			ind = len(str) - 1
-		} else {
-			return i.Fail(e)
-		}
+	str := []rune(args[0].AsString())
+	ind, rc := i.getIndex(args[1], len(str))
+	if rc != kTclOK {
+		return rc
 	}
-	if ind >= len(str) {
+	if ind < 0 || ind >= len(str) {
 		return i.Return(kNil)
 	}
-	return i.Return(FromStr(str[ind : ind+1]))
+	return i.Return(FromStr(string(str[ind])))
 }
 
 var arrayEn = ensembleSpec{
@@ -767,9 +839,20 @@ func arraySet(it *Interp, args []*TclObj) TclStatus {
 	if len(items)&1 != 0 {
 		return it.FailStr("list must have even number of elements")
 	}
-	for i := 0; i < len(items)-1; i++ {
-		vn.arrind = &tliteral{strval: items[i].AsString()}
-		it.setVar(vn, items[i+1])
+	if len(items) == 0 {
+		f := it.varFrame(vn.is_global)
+		f, n, v := resolveLinks(f, vn.name, f.lookup(vn.name))
+		if v == nil {
+			f.create(n).arrdata = make(map[string]*TclObj)
+		} else if v.arrdata == nil {
+			return it.FailStr("can't set \"" + vn.name + "\": variable isn't array")
+		}
+	}
+	for i := 0; i < len(items); i += 2 {
+		vn.arrind = newLiteral(items[i].AsString())
+		if rc := it.setVar(vn, items[i+1]); rc != kTclOK {
+			return rc
+		}
 	}
 	return it.Return(kNil)
 }
@@ -779,18 +862,28 @@ func tclSource(i *Interp, args []*TclObj) TclStatus {
 		return i.FailStr("wrong # args")
 	}
 	filename := args[0].AsString()
-	file, e := os.Open(filename)
+	file, e := i.FS().Open(filename)
 	if e != nil {
 		return i.Fail(e)
 	}
 	defer file.Close()
-	cmds, pe := parseCommands(bufio.NewReader(file))
+	cmds, pe := i.parseFile(filename, file)
 	if pe != nil {
 		return i.Fail(pe)
 	}
 	return i.evalCmds(cmds)
 }
 
+// parseFile parses the script read from the file name, noting its
+// commands for coverage if it's being counted.
+func (i *Interp) parseFile(name string, r io.Reader) ([]command, error) {
+	cmds, e := parseCommandsAt(bufio.NewReader(r), srcPos{name, 1})
+	if e == nil && i.cover != nil {
+		i.cover.add(cmds)
+	}
+	return cmds, e
+}
+
 func splitWith(s string, fn func(rune) bool) []string {
 	res := make([]string, 0, 4)
 	for {
@@ -825,29 +918,12 @@ func tclSplit(i *Interp, args []*TclObj) TclStatus {
 	return i.Return(FromList(strs))
 }
 
-func tclLsearch(i *Interp, args []*TclObj) TclStatus {
-	if len(args) != 2 {
-		return i.FailStr("wrong # args")
-	}
-	lst, err := args[0].AsList()
-	if err != nil {
-		return i.Fail(err)
-	}
-	pat := args[1].AsString()
-	for ind, v := range lst {
-		if v.AsString() == pat {
-			return i.Return(FromInt(ind))
-		}
-	}
-	return i.Return(FromInt(-1))
-}
-
 func tclRename(i *Interp, args []*TclObj) TclStatus {
 	if len(args) != 2 {
 		return i.FailStr("wrong # args")
 	}
 	oldn, newn := args[0].AsString(), args[1].AsString()
-	oldc, ok := i.cmds[oldn]
+	_, ok := i.cmds[oldn]
 	if newn == "" {
 		if !ok {
 			return i.FailStr("can't delete command, doesn't exist")
@@ -857,28 +933,63 @@ func tclRename(i *Interp, args []*TclObj) TclStatus {
 		if !ok {
 			return i.FailStr("can't rename command, doesn't exist")
 		}
-		i.SetCmd(oldn, nil)
-		i.SetCmd(newn, oldc)
+		i.renameCmd(oldn, newn)
 	}
 	return i.Return(kNil)
 }
 
+// renameCmd renames the command oldn, which exists, to newn.
+func (i *Interp) renameCmd(oldn, newn string) {
+	oldc := i.cmds[oldn]
+	ci, moving := i.cmdinfo[oldn]
+	delete(i.cmdinfo, oldn)
+	i.SetCmd(oldn, nil)
+	i.SetCmd(newn, oldc)
+	if moving {
+		i.cmdinfo[newn] = ci
+	}
+	if ci := i.info(newn); ci.proc == nil {
+		if ci.origin == "" {
+			ci.origin = oldn
+		}
+		if ci.origin == newn {
+			ci.origin = ""
+		}
+	}
+}
+
+// asLambda returns the proc apply makes from t, which is kept on t so
+// it's only parsed and compiled once.
+func (t *TclObj) asLambda() (TclCmd, error) {
+	if p := t.reps().procval.Load(); p != nil {
+		return *p, nil
+	}
+	lambda, e := t.AsList()
+	if e != nil {
+		return nil, e
+	}
+	if len(lambda) != 2 {
+		return nil, errors.New("invalid lambda")
+	}
+	sig, e := lambda[0].AsList()
+	if e != nil {
+		return nil, e
+	}
+	proc := makeProc("apply lambdaExpr", sig, lambda[1])
+	t.ownReps().procval.Store(&proc)
+	return proc, nil
+}
+
 func tclApply(i *Interp, args []*TclObj) TclStatus {
 	if len(args) < 1 {
 		return i.FailStr("wrong # args")
 	}
-	lambda, e := args[0].AsList()
+	proc, e := args[0].asLambda()
 	if e != nil {
 		return i.Fail(e)
 	}
-	if len(lambda) != 2 {
-		return i.FailStr("invalid lambda")
-	}
-	sig, se := lambda[0].AsList()
-	if se != nil {
-		return i.Fail(se)
-	}
-	return makeProc(sig, lambda[1])(i, args[1:])
+	i.cmdname = "apply lambdaExpr"
+	return proc(i, args[1:])
 }
 
 var tclBasicCmds = make(map[string]TclCmd)
@@ -908,6 +1019,7 @@ func init() {
 		"lindex":   tclLindex,
 		"list":     tclList,
 		"llength":  tclLlength,
+		"lmap":     tclLmap,
 		"lsearch":  tclLsearch,
 		"open":     tclOpen,
 		"puts":     tclPuts,
@@ -928,8 +1040,14 @@ func init() {
 	}
 }
 
+// The builtins compiled inline that RegisterDefaultCmd has replaced.
+var inlineReplaced = make(map[string]bool)
+
 // Register a command to be available in all Interps.
 // Should be called from init().
 func RegisterDefaultCmd(name string, cmd TclCmd) {
+	if inlineCmds[name] {
+		inlineReplaced[name] = true
+	}
 	tclBasicCmds[name] = cmd
 }
@@ -0,0 +1,707 @@
+package gotcl
+
+// The compiler turns parsed scripts into bytecode for the stack machine
+// in vm.go. Within proc bodies, variables with names known at compile
+// time live in slots of the frame rather than in its map, and the bodies
+// of if, while, for, foreach and expr are compiled inline along with
+// the other builtins listed in inlineCmds. Anything it doesn't
+// understand is left to the tree interpreter.
+
+type opcode uint8
+
+const (
+	opPush         opcode = iota // push consts[a]
+	opPop                        // discard the top of the stack
+	opLoad                       // push local slot a
+	opStore                      // set local slot a to the top of the stack
+	opLoadVar                    // push the variable vrefs[a]
+	opStoreVar                   // set the variable vrefs[a] to the top of the stack
+	opIncr                       // add the top of the stack to local slot a
+	opIncrVar                    // add the top of the stack to the variable vrefs[a]
+	opIncrImm                    // add b to local slot a and push the result
+	opIncrVarImm                 // add b to the variable vrefs[a] and push the result
+	opConcat                     // replace the top a values with their concatenation
+	opInvoke                     // call calls[a] with its words on the stack
+	opInvokeConst                // call calls[a] with its constant words
+	opEvalCmd                    // evaluate cmds[a] with the tree interpreter
+	opEvalExpr                   // evaluate exprs[a] with the tree interpreter
+	opEvalTok                    // evaluate toks[a] with the tree interpreter
+	opBinop                      // apply binops[a] to the top two values
+	opBinopLocals                // push localOps[a] applied to two local slots
+	opNot                        // logical not of the top of the stack
+	opBitNot                     // bitwise not of the top of the stack
+	opToBool                     // convert the top of the stack to 0 or 1
+	opFunc                       // call the math function funcs[a]
+	opJump                       // continue at a
+	opJumpTrue                   // pop a value and continue at a if it's true
+	opJumpFalse                  // pop a value and continue at a if it's false
+	opCmd                        // start of a command: count it and check limits
+	opInline                     // opCmd for inlines[a], evaluating it if redefined
+	opCheck                      // start of a loop iteration: check limits
+	opForeachStart               // pop the lists for foreachs[a] and start iterating
+	opForeachStep                // assign the next values, or continue at the end
+	opForeachEnd                 // finish the innermost foreach
+	opReturn                     // pop a value and return it from the proc
+	opBreak
+	opContinue
+)
+
+type instr struct {
+	op opcode
+	b  int16 // an immediate operand, for the few that take two
+	a  int32
+}
+
+// A varTarget is a variable the compiler has resolved as far as it
+// can: a slot if it's a local, or else an index into vrefs.
+type varTarget struct {
+	slot, vref int
+}
+
+// A call is a command invoked by compiled code, with the values of
+// its argc words on the stack, or constant words in argv.
+type call struct {
+	argv []*TclObj
+	argc int
+	site *callSite
+}
+
+// An inlineGuard is a builtin compiled inline. If the interp running
+// the code has redefined it, the command is evaluated from cmds[cmd]
+// instead, and the code continues at skip.
+type inlineGuard struct {
+	name      string
+	cmd, skip int
+}
+
+type funcCall struct {
+	fn   *exprFunc
+	argc int
+}
+
+type foreachInfo struct {
+	vars [][]varTarget // for each list, the variables it assigns
+	end  int
+}
+
+// loopRange tells the machine where to go when a break or continue
+// reaches it from code between start and end.
+type loopRange struct {
+	start, end      int
+	breakpc, contpc int
+	depth           int // stack depth in the body
+	iters           int // foreach iterations live in the body
+}
+
+type bytecode struct {
+	code     []instr
+	consts   []*TclObj
+	vrefs    []varRef
+	calls    []call
+	inlines  []inlineGuard
+	cmds     []command
+	exprs    []eterm
+	toks     []tclTok
+	binops   []*binaryOp
+	localOps []localBinop
+	funcs    []funcCall
+	foreachs []*foreachInfo
+	loops    []loopRange
+	ltab     *localTable // nil outside procs
+	tree     []command   // the source, for running without the compiled form
+	// Set for a lone command of constant words with no loop, outside
+	// a proc, which is quicker to interpret than to start the machine
+	// for.
+	walk bool
+}
+
+// localTable maps the names of a compiled proc's local variables to
+// the slots where they're kept in its frames.
+type localTable struct {
+	names []string
+	index map[string]int
+}
+
+func (lt *localTable) slot(name string) int {
+	if ix, ok := lt.index[name]; ok {
+		return ix
+	}
+	if lt.index == nil {
+		lt.index = make(map[string]int)
+	}
+	ix := len(lt.names)
+	lt.index[name] = ix
+	lt.names = append(lt.names, name)
+	return ix
+}
+
+// Builtins compiled inline. Each inlined call checks whether the interp
+// running it has redefined the builtin, and calls the command it has
+// instead if so.
+var inlineCmds = func() map[string]bool {
+	m := map[string]bool{
+		"break": true, "continue": true, "expr": true, "for": true,
+		"foreach": true, "if": true, "incr": true, "return": true,
+		"set": true, "while": true,
+	}
+	for _, o := range binOps {
+		m[o.name] = true
+	}
+	return m
+}()
+
+type compiler struct {
+	bc    *bytecode
+	depth int
+	iters int
+	// The highest pc handed out by pc, which may be a jump target,
+	// so the instructions before it mustn't be merged with any after.
+	fence int
+}
+
+// localBinop is a binary operator applied to two local variables.
+type localBinop struct {
+	op   *binaryOp
+	x, y int
+}
+
+// compile makes bytecode for cmds. If ltab isn't nil, simple variable
+// names are added to it and resolved to slots.
+func compile(cmds []command, ltab *localTable) *bytecode {
+	c := &compiler{bc: &bytecode{ltab: ltab, tree: cmds}}
+	c.script(cmds)
+	c.bc.walk = ltab == nil && len(cmds) == 1 && cmds[0].simple != nil && len(c.bc.loops) == 0
+	return c.bc
+}
+
+func (c *compiler) emit(op opcode, a int, delta int) int {
+	c.bc.code = append(c.bc.code, instr{op: op, a: int32(a)})
+	c.depth += delta
+	return len(c.bc.code) - 1
+}
+
+func (c *compiler) pc() int {
+	c.fence = max(c.fence, len(c.bc.code))
+	return len(c.bc.code)
+}
+
+func (c *compiler) patch(at int) { c.bc.code[at].a = int32(c.pc()) }
+
+func (c *compiler) push(v *TclObj) {
+	c.bc.consts = append(c.bc.consts, v)
+	c.emit(opPush, len(c.bc.consts)-1, 1)
+}
+
+func (c *compiler) script(cmds []command) {
+	if len(cmds) == 0 {
+		c.push(kNil)
+		return
+	}
+	for ix := range cmds {
+		if ix > 0 {
+			c.emit(opPop, 0, -1)
+		}
+		c.command(&cmds[ix])
+	}
+}
+
+// body compiles a script given as the argument of a builtin.
+func (c *compiler) body(obj *TclObj) {
+	cmds, _ := obj.asCmds()
+	c.script(cmds)
+}
+
+func (c *compiler) command(cmd *command) {
+	if !cmd.no_expand {
+		c.bc.cmds = append(c.bc.cmds, *cmd)
+		c.emit(opEvalCmd, len(c.bc.cmds)-1, 1)
+		return
+	}
+	if len(cmd.words) == 0 {
+		c.emit(opCmd, 0, 0)
+		c.push(kNil)
+		return
+	}
+	if name, ok := cmd.words[0].(simpleTok); ok {
+		if n := name.AsTclObj().AsString(); inlineCmds[n] && c.inline(n, cmd) {
+			return
+		}
+	}
+	c.emit(opCmd, 0, 0)
+	if cmd.simple != nil {
+		argv := make([]*TclObj, 0, len(cmd.words))
+		argv = append(append(argv, cmd.words[0].(simpleTok).AsTclObj()), cmd.simple.args...)
+		c.bc.calls = append(c.bc.calls, call{argv: argv, site: cmd.site})
+		c.emit(opInvokeConst, len(c.bc.calls)-1, 1)
+		return
+	}
+	for _, w := range cmd.words {
+		c.word(w)
+	}
+	c.bc.calls = append(c.bc.calls, call{argc: len(cmd.words), site: cmd.site})
+	c.emit(opInvoke, len(c.bc.calls)-1, 1-len(cmd.words))
+}
+
+// inline compiles cmd, a call to the builtin name, inline, guarded so
+// that it's evaluated as written if name is redefined, returning false
+// if the arguments aren't in a form it can compile.
+func (c *compiler) inline(name string, cmd *command) bool {
+	ix := len(c.bc.inlines)
+	c.bc.inlines = append(c.bc.inlines, inlineGuard{name: name, cmd: len(c.bc.cmds)})
+	c.bc.cmds = append(c.bc.cmds, *cmd)
+	at := c.emit(opInline, ix, 0)
+	if !c.builtin(name, cmd.words[1:]) {
+		// Nothing has been emitted past the guard.
+		c.bc.code = c.bc.code[:at]
+		c.bc.inlines = c.bc.inlines[:ix]
+		c.bc.cmds = c.bc.cmds[:len(c.bc.cmds)-1]
+		return false
+	}
+	c.bc.inlines[ix].skip = c.pc()
+	return true
+}
+
+func (c *compiler) word(w tclTok) {
+	switch t := w.(type) {
+	case simpleTok:
+		c.push(t.AsTclObj())
+	case varRef:
+		c.load(c.varRefTarget(t))
+	case *subcommand:
+		c.command(&t.cmd)
+	case strlit:
+		c.strlit(t)
+	default:
+		c.bc.toks = append(c.bc.toks, w)
+		c.emit(opEvalTok, len(c.bc.toks)-1, 1)
+	}
+}
+
+func (c *compiler) strlit(s strlit) {
+	if len(s.toks) == 0 {
+		c.push(kNil)
+		return
+	}
+	for _, t := range s.toks {
+		switch t.kind {
+		case kRaw:
+			c.push(FromStr(t.value))
+		case kVar:
+			c.load(c.varRefTarget(*t.varref))
+		case kSubcmd:
+			c.command(&t.subcmd.cmd)
+		}
+	}
+	if len(s.toks) > 1 || s.toks[0].kind != kRaw {
+		c.emit(opConcat, len(s.toks), 1-len(s.toks))
+	}
+}
+
+func (c *compiler) varRefTarget(vr varRef) varTarget {
+	if c.bc.ltab != nil && !vr.is_global && vr.arrind == nil {
+		return varTarget{slot: c.bc.ltab.slot(vr.name), vref: -1}
+	}
+	c.bc.vrefs = append(c.bc.vrefs, vr)
+	return varTarget{slot: -1, vref: len(c.bc.vrefs) - 1}
+}
+
+func (c *compiler) varTarget(name *TclObj) varTarget {
+	return c.varRefTarget(name.asVarRef())
+}
+
+func (c *compiler) load(t varTarget) {
+	if t.slot >= 0 {
+		c.emit(opLoad, t.slot, 1)
+	} else {
+		c.emit(opLoadVar, t.vref, 1)
+	}
+}
+
+// literals returns the objects for words if they're all constant.
+func literals(words []tclTok) ([]*TclObj, bool) {
+	objs := make([]*TclObj, len(words))
+	for ix, w := range words {
+		st, ok := w.(simpleTok)
+		if !ok {
+			return nil, false
+		}
+		objs[ix] = st.AsTclObj()
+	}
+	return objs, true
+}
+
+func isScript(obj *TclObj) bool {
+	_, e := obj.asCmds()
+	return e == nil
+}
+
+func isExpr(obj *TclObj) bool {
+	_, e := obj.asExpr()
+	return e == nil
+}
+
+// builtin compiles a call to the builtin name, returning false if
+// args aren't in a form it can compile.
+func (c *compiler) builtin(name string, args []tclTok) bool {
+	switch name {
+	case "set":
+		return c.compileSet(args)
+	case "incr":
+		return c.compileIncr(args)
+	case "if":
+		return c.compileIf(args)
+	case "while":
+		return c.compileWhile(args)
+	case "for":
+		return c.compileFor(args)
+	case "foreach":
+		return c.compileForeach(args)
+	case "expr":
+		if len(args) != 1 {
+			return false
+		}
+		lits, ok := literals(args)
+		if !ok || !isExpr(lits[0]) {
+			return false
+		}
+		e, _ := lits[0].asExpr()
+		c.expr(e)
+	case "return":
+		if len(args) > 1 {
+			return false
+		}
+		if len(args) == 0 {
+			c.push(kNil)
+		} else {
+			c.word(args[0])
+		}
+		c.emit(opReturn, 0, 0)
+	case "break", "continue":
+		if len(args) != 0 {
+			return false
+		}
+		op := opBreak
+		if name == "continue" {
+			op = opContinue
+		}
+		c.emit(op, 0, 1)
+	default:
+		if len(args) != 2 {
+			return false
+		}
+		for _, o := range binOps {
+			if o.name == name {
+				c.word(args[0])
+				c.word(args[1])
+				c.binop(o)
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (c *compiler) binop(o *binaryOp) {
+	if n := len(c.bc.code); n-2 >= c.fence && c.bc.code[n-2].op == opLoad && c.bc.code[n-1].op == opLoad {
+		// Both operands are locals: read them in place.
+		c.bc.localOps = append(c.bc.localOps, localBinop{o, int(c.bc.code[n-2].a), int(c.bc.code[n-1].a)})
+		c.bc.code = c.bc.code[:n-2]
+		c.emit(opBinopLocals, len(c.bc.localOps)-1, -1)
+		return
+	}
+	c.bc.binops = append(c.bc.binops, o)
+	c.emit(opBinop, len(c.bc.binops)-1, -1)
+}
+
+func (c *compiler) compileSet(args []tclTok) bool {
+	if len(args) != 1 && len(args) != 2 {
+		return false
+	}
+	name, ok := args[0].(simpleTok)
+	if !ok {
+		return false
+	}
+	t := c.varTarget(name.AsTclObj())
+	if len(args) == 1 {
+		c.load(t)
+		return true
+	}
+	c.word(args[1])
+	c.store(t)
+	return true
+}
+
+func (c *compiler) store(t varTarget) {
+	if t.slot >= 0 {
+		c.emit(opStore, t.slot, 0)
+	} else {
+		c.emit(opStoreVar, t.vref, 0)
+	}
+}
+
+func (c *compiler) compileIncr(args []tclTok) bool {
+	if len(args) != 1 && len(args) != 2 {
+		return false
+	}
+	name, ok := args[0].(simpleTok)
+	if !ok {
+		return false
+	}
+	t := c.varTarget(name.AsTclObj())
+	if n, ok := incrImm(args[1:]); ok {
+		op, a := opIncrImm, t.slot
+		if t.slot < 0 {
+			op, a = opIncrVarImm, t.vref
+		}
+		at := c.emit(op, a, 1)
+		c.bc.code[at].b = n
+		return true
+	}
+	c.word(args[1])
+	if t.slot >= 0 {
+		c.emit(opIncr, t.slot, 0)
+	} else {
+		c.emit(opIncrVar, t.vref, 0)
+	}
+	return true
+}
+
+// incrImm returns the amount an incr adds, if it's a constant small
+// enough to go in an instruction.
+func incrImm(amount []tclTok) (int16, bool) {
+	if len(amount) == 0 {
+		return 1, true
+	}
+	lit, ok := amount[0].(simpleTok)
+	if !ok {
+		return 0, false
+	}
+	n, e := lit.AsTclObj().AsInt()
+	return int16(n), e == nil && n == int(int16(n))
+}
+
+func (c *compiler) compileIf(args []tclTok) bool {
+	lits, ok := literals(args)
+	if !ok {
+		return false
+	}
+	conds, bodies, elsebody, err := ifClauses(lits)
+	if err != nil {
+		return false
+	}
+	for ix := range conds {
+		if !isExpr(conds[ix]) || !isScript(bodies[ix]) {
+			return false
+		}
+	}
+	if elsebody != nil && !isScript(elsebody) {
+		return false
+	}
+	start := c.depth
+	var ends []int
+	for ix, cond := range conds {
+		e, _ := cond.asExpr()
+		c.expr(e)
+		next := c.emit(opJumpFalse, 0, -1)
+		c.body(bodies[ix])
+		ends = append(ends, c.emit(opJump, 0, 0))
+		c.patch(next)
+		c.depth = start
+	}
+	if elsebody != nil {
+		c.body(elsebody)
+	} else {
+		c.push(kNil)
+	}
+	for _, at := range ends {
+		c.patch(at)
+	}
+	return true
+}
+
+// loop compiles body as the body of a loop, with continue going to
+// contpc, or to the end of the body if contpc is -1.
+func (c *compiler) loop(body *TclObj, contpc int) (start, end int) {
+	c.emit(opCheck, 0, 0)
+	start = c.pc()
+	c.body(body)
+	c.emit(opPop, 0, -1)
+	end = c.pc()
+	if contpc == -1 {
+		contpc = end
+	}
+	c.bc.loops = append(c.bc.loops, loopRange{start: start, end: end,
+		contpc: contpc, depth: c.depth, iters: c.iters})
+	return
+}
+
+// endLoop sets where breaks from the last loop go, after the code
+// that follows it up to here has been emitted.
+func (c *compiler) endLoop(ix int) {
+	c.bc.loops[ix].breakpc = c.pc()
+}
+
+func (c *compiler) compileWhile(args []tclTok) bool {
+	lits, ok := literals(args)
+	if !ok || len(lits) != 2 || !isExpr(lits[0]) || !isScript(lits[1]) {
+		return false
+	}
+	test, _ := lits[0].asExpr()
+	// The test goes after the body, to save a jump each time round.
+	enter := c.emit(opJump, 0, 0)
+	top := c.pc()
+	c.loop(lits[1], -1)
+	l := len(c.bc.loops) - 1
+	c.patch(enter)
+	c.expr(test)
+	c.emit(opJumpTrue, top, -1)
+	c.endLoop(l)
+	c.push(kNil)
+	return true
+}
+
+func (c *compiler) compileFor(args []tclTok) bool {
+	lits, ok := literals(args)
+	if !ok || len(lits) != 4 || !isScript(lits[0]) || !isExpr(lits[1]) ||
+		!isScript(lits[2]) || !isScript(lits[3]) {
+		return false
+	}
+	test, _ := lits[1].asExpr()
+	c.body(lits[0])
+	c.emit(opPop, 0, -1)
+	enter := c.emit(opJump, 0, 0)
+	top := c.pc()
+	c.loop(lits[3], -1)
+	l := len(c.bc.loops) - 1
+	c.body(lits[2])
+	c.emit(opPop, 0, -1)
+	c.patch(enter)
+	c.expr(test)
+	c.emit(opJumpTrue, top, -1)
+	c.endLoop(l)
+	c.push(kNil)
+	return true
+}
+
+func (c *compiler) compileForeach(args []tclTok) bool {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return false
+	}
+	body, ok := args[len(args)-1].(simpleTok)
+	if !ok || !isScript(body.AsTclObj()) {
+		return false
+	}
+	info := &foreachInfo{}
+	for ix := 0; ix < len(args)-1; ix += 2 {
+		vl, ok := args[ix].(simpleTok)
+		if !ok {
+			return false
+		}
+		names, e := vl.AsTclObj().AsList()
+		if e != nil || len(names) == 0 {
+			return false
+		}
+		vars := make([]varTarget, len(names))
+		for vx, n := range names {
+			vars[vx] = c.varTarget(n)
+		}
+		info.vars = append(info.vars, vars)
+	}
+	for ix := 1; ix < len(args)-1; ix += 2 {
+		c.word(args[ix])
+	}
+	c.bc.foreachs = append(c.bc.foreachs, info)
+	fx := len(c.bc.foreachs) - 1
+	c.emit(opForeachStart, fx, -len(info.vars))
+	c.iters++
+	step := c.emit(opForeachStep, fx, 0)
+	c.loop(body.AsTclObj(), step)
+	l := len(c.bc.loops) - 1
+	c.emit(opJump, step, 0)
+	info.end = c.pc()
+	c.endLoop(l)
+	c.emit(opForeachEnd, 0, 0)
+	c.iters--
+	c.push(kNil)
+	return true
+}
+
+func (c *compiler) expr(e eterm) {
+	switch t := e.(type) {
+	case simpleTok:
+		c.push(t.AsTclObj())
+	case varRef:
+		c.load(c.varRefTarget(t))
+	case strlit:
+		c.strlit(t)
+	case *subcommand:
+		c.command(&t.cmd)
+	case *parenNode:
+		c.expr(t.term)
+	case *unOpNode:
+		if t.op != '!' && t.op != '~' {
+			c.evalExpr(e)
+			return
+		}
+		c.expr(t.v)
+		if t.op == '!' {
+			c.emit(opNot, 0, 0)
+		} else {
+			c.emit(opBitNot, 0, 0)
+		}
+	case *binOpNode:
+		if t.op == andOp || t.op == orOp {
+			c.shortCircuit(t)
+			return
+		}
+		c.expr(t.a)
+		c.expr(t.b)
+		c.binop(t.op)
+	case *ternaryIfNode:
+		c.expr(t.cond)
+		no := c.emit(opJumpFalse, 0, -1)
+		c.expr(t.yes)
+		end := c.emit(opJump, 0, 0)
+		c.patch(no)
+		c.depth--
+		c.expr(t.no)
+		c.patch(end)
+	case *funcNode:
+		fn, ok := mathFuncs[t.name]
+		if !ok || len(t.args) < fn.argmin || len(t.args) > fn.argmax {
+			c.evalExpr(e)
+			return
+		}
+		for _, a := range t.args {
+			c.expr(a)
+		}
+		c.bc.funcs = append(c.bc.funcs, funcCall{fn, len(t.args)})
+		c.emit(opFunc, len(c.bc.funcs)-1, 1-len(t.args))
+	default:
+		c.evalExpr(e)
+	}
+}
+
+func (c *compiler) evalExpr(e eterm) {
+	c.bc.exprs = append(c.bc.exprs, e)
+	c.emit(opEvalExpr, len(c.bc.exprs)-1, 1)
+}
+
+// shortCircuit compiles && and ||, which only evaluate their
+// second operand if the first doesn't settle the result.
+func (c *compiler) shortCircuit(b *binOpNode) {
+	jump, settled := opJumpFalse, kFalse
+	if b.op == orOp {
+		jump, settled = opJumpTrue, kTrue
+	}
+	c.expr(b.a)
+	short := c.emit(jump, 0, -1)
+	c.expr(b.b)
+	c.emit(opToBool, 0, 0)
+	end := c.emit(opJump, 0, 0)
+	c.patch(short)
+	c.depth--
+	c.push(settled)
+	c.patch(end)
+}
@@ -0,0 +1,226 @@
+package gotcl
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FromFloat returns f formatted the way Tcl does, so that it reads
+// back as a float even if it's integral.
+func FromFloat(f float64) *TclObj {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return FromStr(s)
+}
+
+func FromBytes(b []byte) *TclObj {
+	return FromStr(string(b))
+}
+
+// FromObjList returns a list of the objects in l, which is copied.
+func FromObjList(l []*TclObj) *TclObj {
+	return fromList(append([]*TclObj(nil), l...))
+}
+
+// FromDict returns a dict holding the entries of m, in key order.
+func FromDict(m map[string]*TclObj) *TclObj {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := newDict(len(keys))
+	for _, k := range keys {
+		d.put(FromStr(k), m[k])
+	}
+	return fromDict(d)
+}
+
+func (t *TclObj) AsFloat() (float64, error) {
+	if t.has_intval.Load() {
+		return float64(t.intval.Load()), nil
+	}
+	s := t.AsString()
+	f, e := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if e != nil {
+		return 0, errors.New("expected floating-point number but got \"" + s + "\"")
+	}
+	return f, nil
+}
+
+func (t *TclObj) AsBytes() []byte {
+	return []byte(t.AsString())
+}
+
+func (t *TclObj) AsStringList() ([]string, error) {
+	l, e := t.AsList()
+	if e != nil {
+		return nil, e
+	}
+	sl := make([]string, len(l))
+	for ix, v := range l {
+		sl[ix] = v.AsString()
+	}
+	return sl, nil
+}
+
+// AsDict returns the entries of t, which must be a list of keys and
+// values. Later entries replace earlier ones with the same key.
+func (t *TclObj) AsDict() (map[string]*TclObj, error) {
+	d, e := t.asDict()
+	if e != nil {
+		return nil, e
+	}
+	m := make(map[string]*TclObj, d.size())
+	keys, vals := d.items()
+	for ix, k := range keys {
+		m[k.AsString()] = vals[ix]
+	}
+	return m, nil
+}
+
+// asBoolStrict is AsBool for callers that want an error for values
+// that aren't booleans.
+func (t *TclObj) asBoolStrict() (bool, error) {
+	s := t.AsString()
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	if n, e := t.AsInt(); e == nil {
+		return n != 0, nil
+	}
+	return false, errors.New("expected boolean value but got \"" + s + "\"")
+}
+
+// GetVar returns the variable name in i as a T, which can be any type
+// BindFunc accepts as a parameter. A map is read from an array, or
+// else a dict; a slice is read from a list.
+func GetVar[T any](i *Interp, name string) (T, error) {
+	var res T
+	t := reflect.TypeOf(&res).Elem()
+	conv, e := argConverter(t)
+	if e != nil {
+		return res, e
+	}
+	vr := toVarRef(name)
+	if t.Kind() == reflect.Map && vr.arrind == nil {
+		if v, e := i.lookupVar(vr); e == nil && v.arrdata != nil {
+			rv, e := conv(FromDict(v.arrdata))
+			if e != nil {
+				return res, e
+			}
+			return rv.Interface().(T), nil
+		}
+	}
+	obj, e := i.getVar(vr)
+	if e != nil {
+		return res, e
+	}
+	rv, e := conv(obj)
+	if e != nil {
+		return res, e
+	}
+	return rv.Interface().(T), nil
+}
+
+// SetVar sets the variable name in i to v, converted as BindFunc
+// converts results. A map with string keys replaces name with an
+// array holding its entries.
+func (i *Interp) SetVar(name string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	vr := toVarRef(name)
+	if rv.Kind() == reflect.Map && vr.arrind == nil {
+		conv, e := resultConverter(rv.Type().Elem())
+		if e != nil || rv.Type().Key().Kind() != reflect.String {
+			return errors.New("can't set an array from " + rv.Type().String())
+		}
+		f := i.varFrame(vr.is_global)
+		f, n, arr := resolveLinks(f, vr.name, f.lookup(vr.name))
+		if arr == nil {
+			arr = f.create(n)
+		}
+		*arr = varEntry{arrdata: make(map[string]*TclObj, rv.Len())}
+		iter := rv.MapRange()
+		for iter.Next() {
+			arr.arrdata[iter.Key().String()] = conv(iter.Value())
+		}
+		return nil
+	}
+	if !rv.IsValid() {
+		return errors.New("can't set \"" + name + "\" to nil")
+	}
+	conv, e := resultConverter(rv.Type())
+	if e != nil {
+		return e
+	}
+	if i.setVar(vr, conv(rv)) != kTclOK {
+		return i.err
+	}
+	return nil
+}
+
+// quoteElem returns s quoted so that it reads back as a single word,
+// both as a list element and as a word of a command.
+func quoteElem(s string) string {
+	if s == "" {
+		return "{}"
+	}
+	if !strings.ContainsAny(s, " \t\n\r\v\f{}[]$\";\\") && s[0] != '#' {
+		return s
+	}
+	if canBrace(s) {
+		return "{" + s + "}"
+	}
+	return "\"" + escapeString(s) + "\""
+}
+
+// escapeString returns s with backslashes before the characters that
+// would be substituted in a quoted word.
+func escapeString(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\', '"', '$', '[', ']', '{', '}':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\t':
+			b.WriteString("\\t")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// canBrace reports whether s reads back unchanged between braces: its
+// braces must balance, not counting those after backslashes.
+func canBrace(s string) bool {
+	nest := 0
+	for ix := 0; ix < len(s); ix++ {
+		switch s[ix] {
+		case '\\':
+			if ix++; ix == len(s) {
+				return false
+			}
+		case '{':
+			nest++
+		case '}':
+			if nest--; nest < 0 {
+				return false
+			}
+		}
+	}
+	return nest == 0
+}
@@ -0,0 +1,78 @@
+package gotcl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConversions(t *testing.T) {
+	if s := FromFloat(2).AsString(); s != "2.0" {
+		t.Errorf("FromFloat(2) = %q", s)
+	}
+	if f, e := FromStr("1.5").AsFloat(); e != nil || f != 1.5 {
+		t.Errorf("AsFloat = %v, %v", f, e)
+	}
+	if _, e := FromStr("x").AsFloat(); e == nil {
+		t.Error("AsFloat accepted x")
+	}
+	if n, e := FromInt64(1 << 40).AsInt64(); e != nil || n != 1<<40 {
+		t.Errorf("AsInt64 = %v, %v", n, e)
+	}
+	if b := FromBytes([]byte("hi")).AsBytes(); string(b) != "hi" {
+		t.Errorf("AsBytes = %q", b)
+	}
+	l := FromObjList([]*TclObj{FromStr("a b"), FromInt(1)})
+	if sl, e := l.AsStringList(); e != nil || !reflect.DeepEqual(sl, []string{"a b", "1"}) {
+		t.Errorf("AsStringList = %v, %v", sl, e)
+	}
+	d := FromDict(map[string]*TclObj{"b": FromInt(2), "a": FromInt(1)})
+	if d.AsString() != "a 1 b 2" {
+		t.Errorf("FromDict = %q", d.AsString())
+	}
+	if m, e := d.AsDict(); e != nil || len(m) != 2 || m["b"].AsString() != "2" {
+		t.Errorf("AsDict = %v, %v", m, e)
+	}
+	if _, e := FromStr("a b c").AsDict(); e == nil {
+		t.Error("AsDict accepted an odd list")
+	}
+}
+
+func TestGetSetVar(t *testing.T) {
+	i := NewInterp()
+	check := func(e error) {
+		t.Helper()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	check(i.SetVar("n", 42))
+	check(i.SetVar("f", 0.5))
+	check(i.SetVar("l", []int{1, 2, 3}))
+	check(i.SetVar("arr", map[string]int{"x": 1, "y": 2}))
+	check(i.SetVar("arr2(k)", "v"))
+
+	if n, e := GetVar[int64](i, "n"); e != nil || n != 42 {
+		t.Errorf("n = %v, %v", n, e)
+	}
+	if f, e := GetVar[float64](i, "f"); e != nil || f != 0.5 {
+		t.Errorf("f = %v, %v", f, e)
+	}
+	if l, e := GetVar[[]int](i, "l"); e != nil || !reflect.DeepEqual(l, []int{1, 2, 3}) {
+		t.Errorf("l = %v, %v", l, e)
+	}
+	if m, e := GetVar[map[string]int](i, "arr"); e != nil || !reflect.DeepEqual(m, map[string]int{"x": 1, "y": 2}) {
+		t.Errorf("arr = %v, %v", m, e)
+	}
+	if v, e := GetVar[int](i, "arr(y)"); e != nil || v != 2 {
+		t.Errorf("arr(y) = %v, %v", v, e)
+	}
+	if v, e := GetVar[string](i, "arr2(k)"); e != nil || v != "v" {
+		t.Errorf("arr2(k) = %v, %v", v, e)
+	}
+	if v, e := i.EvalString("array size arr"); e != nil || v.AsString() != "2" {
+		t.Errorf("array size = %v, %v", v, e)
+	}
+	if _, e := GetVar[int](i, "f"); e == nil {
+		t.Error("read a float as an int")
+	}
+}
@@ -0,0 +1,253 @@
+package gotcl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Coverage counts how many times each line of the files an interp
+// sources has had a command start on it.
+type Coverage struct {
+	fsys VFS
+	// Hits by line, for each line a command starts on, by file.
+	files map[string]map[int]int
+}
+
+// StartCoverage has i count the commands run on each line of the files
+// it sources from now on, until StopCoverage is called. Scripts are
+// interpreted rather than compiled meanwhile.
+func (i *Interp) StartCoverage() *Coverage {
+	if i.cover == nil {
+		i.cover = &Coverage{fsys: i.FS(), files: make(map[string]map[int]int)}
+	}
+	return i.cover
+}
+
+// StopCoverage stops the counting StartCoverage started, returning the
+// counts, or nil if i wasn't counting.
+func (i *Interp) StopCoverage() *Coverage {
+	c := i.cover
+	if c != nil {
+		i.cover = nil
+		i.covered = c
+	}
+	return c
+}
+
+func (c *Coverage) lines(file string) map[int]int {
+	l, ok := c.files[file]
+	if !ok {
+		l = make(map[int]int)
+		c.files[file] = l
+	}
+	return l
+}
+
+func (c *Coverage) hit(pos srcPos) {
+	if pos.file != "" {
+		c.lines(pos.file)[pos.line]++
+	}
+}
+
+// add records the lines of cmds as ones that might run, along with
+// those of the scripts they're given to run that are known, such as
+// proc bodies, so lines that never run are reported as such.
+func (c *Coverage) add(cmds []command) {
+	for ix := range cmds {
+		cmd := &cmds[ix]
+		if cmd.pos.file == "" || len(cmd.words) == 0 {
+			continue
+		}
+		lines := c.lines(cmd.pos.file)
+		if _, ok := lines[cmd.pos.line]; !ok {
+			lines[cmd.pos.line] = 0
+		}
+		for _, w := range scriptWords(cmd.words) {
+			if b, ok := w.(*block); ok {
+				if body, e := b.tval.asCmds(); e == nil {
+					c.add(body)
+				}
+			}
+		}
+	}
+}
+
+// scriptWords returns those of words, a command, that the builtin it
+// calls evaluates as scripts.
+func scriptWords(words []tclTok) []tclTok {
+	name, ok := words[0].(simpleTok)
+	if !ok {
+		return nil
+	}
+	at := func(ixs ...int) []tclTok {
+		var res []tclTok
+		for _, ix := range ixs {
+			if ix > 0 && ix < len(words) {
+				res = append(res, words[ix])
+			}
+		}
+		return res
+	}
+	switch name.AsTclObj().AsString() {
+	case "proc":
+		return at(3)
+	case "while":
+		return at(2)
+	case "for":
+		return at(1, 3, 4)
+	case "foreach", "lmap":
+		return at(len(words) - 1)
+	case "catch", "time":
+		return at(1)
+	case "dict":
+		if len(words) < 2 {
+			return nil
+		}
+		if sub, ok := words[1].(simpleTok); ok {
+			switch sub.AsTclObj().AsString() {
+			case "for", "map", "with", "update", "filter":
+				return at(len(words) - 1)
+			}
+		}
+		return nil
+	case "if":
+		var res []tclTok
+		word := func(ix int) string {
+			if ix < len(words) {
+				if s, ok := words[ix].(simpleTok); ok {
+					return s.AsTclObj().AsString()
+				}
+			}
+			return ""
+		}
+		for ix := 2; ix < len(words); {
+			if word(ix) == "then" {
+				ix++
+			}
+			res = append(res, at(ix)...)
+			switch word(ix + 1) {
+			case "elseif":
+				ix += 3
+			case "else":
+				return append(res, at(ix+2)...)
+			default:
+				return append(res, at(ix+1)...)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Files returns the names of the files with lines counted, sorted.
+func (c *Coverage) Files() []string {
+	names := make([]string, 0, len(c.files))
+	for n := range c.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lines returns the lines of file commands start on, sorted, and how
+// many times each has had one run.
+func (c *Coverage) Lines(file string) (lines, hits []int) {
+	for l := range c.files[file] {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	for _, l := range lines {
+		hits = append(hits, c.files[file][l])
+	}
+	return lines, hits
+}
+
+func (c *Coverage) summary(file string) (run, total int) {
+	for _, n := range c.files[file] {
+		if n > 0 {
+			run++
+		}
+	}
+	return run, len(c.files[file])
+}
+
+// WriteReport writes each file to w with the count for each of its
+// lines, or ##### for those that never ran, as gcov does.
+func (c *Coverage) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range c.Files() {
+		run, total := c.summary(name)
+		fmt.Fprintf(bw, "%s: %d of %d lines run (%.1f%%)\n", name, run, total, 100*float64(run)/float64(total))
+		f, e := c.fsys.Open(name)
+		if e != nil {
+			fmt.Fprintf(bw, "(%s)\n", e)
+			continue
+		}
+		lines := c.files[name]
+		sc := bufio.NewScanner(f)
+		for ln := 1; sc.Scan(); ln++ {
+			count := "-"
+			if n, ok := lines[ln]; ok && n == 0 {
+				count = "#####"
+			} else if ok {
+				count = fmt.Sprint(n)
+			}
+			fmt.Fprintf(bw, "%9s:%5d:%s\n", count, ln, sc.Text())
+		}
+		f.Close()
+	}
+	return bw.Flush()
+}
+
+// WriteLCOV writes the counts to w as an LCOV tracefile, for genhtml
+// and the like.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("TN:\n")
+	for _, name := range c.Files() {
+		fmt.Fprintf(bw, "SF:%s\n", name)
+		lines, hits := c.Lines(name)
+		for ix, l := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l, hits[ix])
+		}
+		run, total := c.summary(name)
+		fmt.Fprintf(bw, "LH:%d\nLF:%d\nend_of_record\n", run, total)
+	}
+	return bw.Flush()
+}
+
+// coverageWrite makes a coverage subcommand writing the counts with
+// write, to the file named, or as its result if there's no name.
+func coverageWrite(cmd string, write func(*Coverage, io.Writer) error) func(*Interp, []*TclObj) TclStatus {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		c := i.cover
+		if c == nil {
+			c = i.covered
+		}
+		switch {
+		case c == nil:
+			return i.FailStr("no coverage has been counted")
+		case len(args) == 0:
+			var sb strings.Builder
+			write(c, &sb)
+			return i.Return(FromStr(sb.String()))
+		case len(args) != 1:
+			return i.FailStr("wrong # args: should be \"coverage " + cmd + " ?fileName?\"")
+		}
+		return i.writeFile(args[0].AsString(), func(w io.Writer) error { return write(c, w) })
+	}
+}
+
+var coverageEn = ensembleSpec{
+	"start":  func(i *Interp) { i.StartCoverage() },
+	"stop":   func(i *Interp) { i.StopCoverage() },
+	"report": coverageWrite("report", (*Coverage).WriteReport),
+	"lcov":   coverageWrite("lcov", (*Coverage).WriteLCOV),
+}
+
+func init() {
+	RegisterDefaultCmd("coverage", coverageEn.makeCmd())
+}
@@ -0,0 +1,54 @@
+package gotcl
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const coverProg = `proc sign {n} {
+    if {$n < 0} {
+        return neg
+    } elseif {$n == 0} {
+        return zero
+    } else {
+        return pos
+    }
+}
+proc unused {} {
+    set x 1
+}
+foreach n {1 2 -1} {
+    sign $n
+}
+`
+
+func TestCoverage(t *testing.T) {
+	i := NewInterp()
+	i.SetVFS(FromFS(fstest.MapFS{"prog.tcl": {Data: []byte(coverProg)}}))
+	i.StartCoverage()
+	if _, e := i.EvalString("source prog.tcl"); e != nil {
+		t.Fatal(e)
+	}
+	c := i.StopCoverage()
+	lines, hits := c.Lines("prog.tcl")
+	var got []string
+	for ix, l := range lines {
+		got = append(got, FromInt(l).AsString()+":"+FromInt(hits[ix]).AsString())
+	}
+	want := "1:1 2:3 3:1 5:0 7:2 10:1 11:0 13:1 14:3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	v, e := i.EvalString("coverage lcov")
+	if e != nil || !strings.Contains(v.AsString(), "SF:prog.tcl\nDA:1,1\n") ||
+		!strings.HasSuffix(v.AsString(), "LH:7\nLF:9\nend_of_record\n") {
+		t.Errorf("lcov: got %v, %v", v, e)
+	}
+	v, e = i.EvalString("coverage report")
+	if e != nil || !strings.HasPrefix(v.AsString(), "prog.tcl: 7 of 9 lines run (77.8%)\n") ||
+		!strings.Contains(v.AsString(), "\n    #####:    5:        return zero\n") ||
+		!strings.Contains(v.AsString(), "\n        -:    4:    } elseif {$n == 0} {\n") {
+		t.Errorf("report: got %v, %v", v, e)
+	}
+}
@@ -0,0 +1,373 @@
+package gotcl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ServeDAP debugs a script in i for an editor speaking the Debug Adapter
+// Protocol over r and w, returning when the editor disconnects. It
+// supports the requests needed to launch a script, with its program
+// argument naming the file to source, and to set breakpoints, step,
+// and look at frames and variables. What the script writes to stdout
+// and stderr is sent to the editor as output.
+func ServeDAP(i *Interp, r io.Reader, w io.Writer) error {
+	s := &dapServer{
+		i:      i,
+		w:      w,
+		jobs:   make(chan func()),
+		resume: make(chan DebugAction),
+		done:   make(chan struct{}),
+	}
+	s.d = i.Debug(s.onStop)
+	stdout, stderr := i.chans["stdout"], i.chans["stderr"]
+	i.chans["stdout"] = dapOutput{s, "stdout"}
+	i.chans["stderr"] = dapOutput{s, "stderr"}
+	defer func() {
+		s.d.Detach()
+		i.chans["stdout"], i.chans["stderr"] = stdout, stderr
+	}()
+	br := bufio.NewReader(r)
+	for {
+		var req dapRequest
+		if e := readDAP(br, &req); e != nil {
+			s.abort()
+			if e == io.EOF {
+				return nil
+			}
+			return e
+		}
+		body, e := s.handle(&req)
+		s.respond(&req, body, e)
+		s.release()
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "disconnect":
+			s.abort()
+			return nil
+		}
+	}
+}
+
+type jsonObj = map[string]interface{}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapServer struct {
+	i *Interp
+	d *Debugger
+
+	wmu sync.Mutex
+	w   io.Writer
+	seq int
+
+	program     string
+	stopOnEntry bool
+
+	mu       sync.Mutex
+	stopped  bool
+	quitting bool
+	// While it's stopped, the script runs jobs sent it until it's sent
+	// how to go on.
+	jobs    chan func()
+	resume  chan DebugAction
+	next    *DebugAction // to send resume after responding
+	running bool
+	cancel  context.CancelFunc // aborts the script, even if it's running
+	done    chan struct{}
+}
+
+// readDAP reads a message, with its Content-Length header, into v.
+func readDAP(r *bufio.Reader, v interface{}) error {
+	size := -1
+	for {
+		ln, e := r.ReadString('\n')
+		if e != nil {
+			return e
+		}
+		ln = strings.TrimSpace(ln)
+		if ln == "" {
+			break
+		}
+		if k, val, ok := strings.Cut(ln, ":"); ok && strings.EqualFold(k, "Content-Length") {
+			if size, e = strconv.Atoi(strings.TrimSpace(val)); e != nil {
+				return errors.New("bad Content-Length: " + val)
+			}
+		}
+	}
+	if size < 0 {
+		return errors.New("missing Content-Length")
+	}
+	buf := make([]byte, size)
+	if _, e := io.ReadFull(r, buf); e != nil {
+		return e
+	}
+	return json.Unmarshal(buf, v)
+}
+
+func (s *dapServer) send(msg jsonObj) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	msg["seq"] = s.seq
+	data, _ := json.Marshal(msg)
+	io.WriteString(s.w, "Content-Length: "+strconv.Itoa(len(data))+"\r\n\r\n")
+	s.w.Write(data)
+}
+
+func (s *dapServer) respond(req *dapRequest, body interface{}, e error) {
+	msg := jsonObj{
+		"type":        "response",
+		"request_seq": req.Seq,
+		"command":     req.Command,
+		"success":     e == nil,
+	}
+	if e != nil {
+		msg["message"] = e.Error()
+	} else if body != nil {
+		msg["body"] = body
+	}
+	s.send(msg)
+}
+
+func (s *dapServer) event(name string, body interface{}) {
+	msg := jsonObj{"type": "event", "event": name}
+	if body != nil {
+		msg["body"] = body
+	}
+	s.send(msg)
+}
+
+type dapOutput struct {
+	s        *dapServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.s.event("output", jsonObj{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+func (s *dapServer) handle(req *dapRequest) (interface{}, error) {
+	var args struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+		Source      struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int    `json:"line"`
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+		FrameID      int    `json:"frameId"`
+		VariablesRef int    `json:"variablesReference"`
+		Expression   string `json:"expression"`
+	}
+	if len(req.Arguments) != 0 {
+		if e := json.Unmarshal(req.Arguments, &args); e != nil {
+			return nil, e
+		}
+	}
+	switch req.Command {
+	case "initialize":
+		return jsonObj{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+		}, nil
+	case "launch":
+		s.program, s.stopOnEntry = args.Program, args.StopOnEntry
+		return nil, nil
+	case "setBreakpoints":
+		s.d.ClearLineBreaks(args.Source.Path)
+		var bps []jsonObj
+		for _, b := range args.Breakpoints {
+			s.d.BreakLine(args.Source.Path, b.Line)
+			bps = append(bps, jsonObj{"verified": true, "line": b.Line})
+		}
+		return jsonObj{"breakpoints": bps}, nil
+	case "setFunctionBreakpoints":
+		s.d.ClearProcBreaks()
+		var bps []jsonObj
+		for _, b := range args.Breakpoints {
+			s.d.BreakProc(b.Name)
+			bps = append(bps, jsonObj{"verified": true})
+		}
+		return jsonObj{"breakpoints": bps}, nil
+	case "configurationDone":
+		return nil, s.run()
+	case "threads":
+		return jsonObj{"threads": []jsonObj{{"id": 1, "name": "main"}}}, nil
+	case "stackTrace":
+		var frames []jsonObj
+		e := s.job(func() {
+			for _, f := range s.d.Backtrace() {
+				frame := jsonObj{"id": f.Level + 1, "name": "global", "line": f.Line, "column": 1}
+				if f.Proc != "" {
+					frame["name"] = fromList(append([]*TclObj{FromStr(f.Proc)}, f.Args...)).AsString()
+				}
+				if f.File != "" {
+					frame["source"] = jsonObj{"name": path.Base(f.File), "path": f.File}
+				}
+				frames = append(frames, frame)
+			}
+		})
+		return jsonObj{"stackFrames": frames, "totalFrames": len(frames)}, e
+	case "scopes":
+		name := "Locals"
+		if args.FrameID == 1 {
+			name = "Globals"
+		}
+		return jsonObj{"scopes": []jsonObj{{"name": name, "variablesReference": args.FrameID, "expensive": false}}}, nil
+	case "variables":
+		var vars []jsonObj
+		var err error
+		e := s.job(func() {
+			var vs []Var
+			vs, err = s.d.Vars(args.VariablesRef - 1)
+			for _, v := range vs {
+				vars = append(vars, jsonObj{"name": v.Name, "value": v.Value, "variablesReference": 0})
+			}
+		})
+		if e == nil {
+			e = err
+		}
+		return jsonObj{"variables": vars}, e
+	case "evaluate":
+		var res *TclObj
+		var err error
+		e := s.job(func() {
+			level := args.FrameID - 1
+			if args.FrameID == 0 {
+				level = len(s.d.calls) - 1
+			}
+			res, err = s.d.Eval(level, args.Expression)
+		})
+		if e == nil {
+			e = err
+		}
+		if e != nil {
+			return nil, e
+		}
+		return jsonObj{"result": res.AsString(), "variablesReference": 0}, nil
+	case "continue":
+		return jsonObj{"allThreadsContinued": true}, s.proceed(DebugContinue)
+	case "next":
+		return nil, s.proceed(DebugStepOver)
+	case "stepIn":
+		return nil, s.proceed(DebugStepInto)
+	case "stepOut":
+		return nil, s.proceed(DebugStepOut)
+	case "disconnect":
+		return nil, nil
+	}
+	return nil, errors.New("unsupported request \"" + req.Command + "\"")
+}
+
+// run sources the program in the background, reporting when it's done.
+func (s *dapServer) run() error {
+	if s.running {
+		return errors.New("already running")
+	}
+	if s.program == "" {
+		return errors.New("no program to launch")
+	}
+	s.running = true
+	if s.stopOnEntry {
+		s.d.Step(DebugStepInto)
+	}
+	script := FromList([]string{"source", s.program}).AsString()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		defer close(s.done)
+		code := 0
+		if _, e := s.i.EvalContext(ctx, script); e != nil {
+			s.event("output", jsonObj{"category": "stderr", "output": e.Error() + "\n"})
+			code = 1
+		}
+		s.event("exited", jsonObj{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+	return nil
+}
+
+func (s *dapServer) onStop(d *Debugger, st *Stop) DebugAction {
+	s.mu.Lock()
+	if s.quitting {
+		s.mu.Unlock()
+		return DebugAbort
+	}
+	s.stopped = true
+	s.mu.Unlock()
+	s.event("stopped", jsonObj{"reason": st.Reason, "threadId": 1, "allThreadsStopped": true})
+	for {
+		select {
+		case job := <-s.jobs:
+			job()
+		case a := <-s.resume:
+			return a
+		}
+	}
+}
+
+// job runs fn in the script's goroutine, if it's stopped.
+func (s *dapServer) job(fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		return errors.New("not stopped")
+	}
+	done := make(chan struct{})
+	s.jobs <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+	return nil
+}
+
+// proceed has the stopped script go on as a says, once the response
+// to the request has been sent, so it comes before any stopped event.
+func (s *dapServer) proceed(a DebugAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		return errors.New("not stopped")
+	}
+	s.stopped = false
+	s.next = &a
+	return nil
+}
+
+func (s *dapServer) release() {
+	if a := s.next; a != nil {
+		s.next = nil
+		s.resume <- *a
+	}
+}
+
+// abort fails the script, whether it's stopped or running, and waits
+// for it to finish.
+func (s *dapServer) abort() {
+	s.mu.Lock()
+	s.quitting = true
+	s.mu.Unlock()
+	s.proceed(DebugAbort)
+	s.release()
+	if s.running {
+		s.cancel()
+		<-s.done
+	}
+}
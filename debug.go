@@ -0,0 +1,348 @@
+package gotcl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A DebugAction tells a stopped script how to go on.
+type DebugAction int
+
+const (
+	DebugContinue DebugAction = iota // run to the next breakpoint
+	DebugStepInto                    // stop at the next command
+	DebugStepOver                    // stop at the next command not in a call made from here
+	DebugStepOut                     // stop at the next command after this proc returns
+	DebugAbort                       // fail the script
+)
+
+// A Stop says where and why a script stopped.
+type Stop struct {
+	Reason  string // "breakpoint" or "step"
+	File    string // "" if the script wasn't sourced from a file
+	Line    int
+	Command string
+}
+
+// A Frame is the global level or a proc call in a stopped script.
+type Frame struct {
+	Level   int    // as for uplevel #Level
+	Proc    string // "" at the global level
+	Args    []*TclObj
+	File    string // where the frame's current command is
+	Line    int
+	Command string
+}
+
+// A Var is a variable in a frame. Arrays are shown as by array get.
+type Var struct {
+	Name, Value string
+}
+
+type debugCall struct {
+	proc  string
+	args  []*TclObj
+	frame *stackframe
+	cmd   *command
+}
+
+// A Debugger stops the scripts an interp runs at breakpoints and steps,
+// and lets its client look at and evaluate in their frames meanwhile.
+// Breakpoints can be set from any goroutine; the rest of its methods
+// are for OnStop.
+type Debugger struct {
+	i *Interp
+	// OnStop is called in the script's goroutine each time it stops,
+	// and returns how to go on.
+	OnStop func(d *Debugger, s *Stop) DebugAction
+
+	mu         sync.Mutex
+	procBreaks map[string]bool
+	lineBreaks map[int][]string // files, by line
+
+	action   DebugAction
+	depth    int // of calls when action was chosen
+	entered  bool
+	stopping bool
+	calls    []debugCall
+}
+
+// Debug attaches a debugger to i, calling onStop whenever a script
+// stops. Scripts run more slowly while it's attached, since they're
+// interpreted rather than compiled.
+func (i *Interp) Debug(onStop func(d *Debugger, s *Stop) DebugAction) *Debugger {
+	d := &Debugger{
+		i:          i,
+		OnStop:     onStop,
+		procBreaks: make(map[string]bool),
+		lineBreaks: make(map[int][]string),
+		calls:      []debugCall{{frame: i.varFrame(true)}},
+	}
+	i.debug = d
+	return d
+}
+
+// Detach lets i's scripts run without stopping.
+func (d *Debugger) Detach() {
+	if d.i.debug == d {
+		d.i.debug = nil
+	}
+}
+
+// Step sets how scripts go on until they next stop, as if a had been
+// chosen at the global level: DebugStepInto stops at the next command.
+func (d *Debugger) Step(a DebugAction) {
+	d.action, d.depth = a, 1
+}
+
+// BreakProc has scripts stop on entering the proc name.
+func (d *Debugger) BreakProc(name string) {
+	d.mu.Lock()
+	d.procBreaks[name] = true
+	d.mu.Unlock()
+}
+
+// BreakLine has scripts stop before each command starting on line of
+// file. file may be the name the script was sourced as, or its tail.
+func (d *Debugger) BreakLine(file string, line int) {
+	d.mu.Lock()
+	d.lineBreaks[line] = append(d.lineBreaks[line], file)
+	d.mu.Unlock()
+}
+
+// ClearProcBreaks removes the breakpoints on procs.
+func (d *Debugger) ClearProcBreaks() {
+	d.mu.Lock()
+	d.procBreaks = make(map[string]bool)
+	d.mu.Unlock()
+}
+
+// ClearLineBreaks removes the breakpoints in file, or all line
+// breakpoints if file is "".
+func (d *Debugger) ClearLineBreaks(file string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for line, files := range d.lineBreaks {
+		var keep []string
+		for _, f := range files {
+			if file != "" && f != file {
+				keep = append(keep, f)
+			}
+		}
+		d.lineBreaks[line] = keep
+	}
+}
+
+func (d *Debugger) atBreak(pos srcPos) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, f := range d.lineBreaks[pos.line] {
+		if f == pos.file || (pos.file != "" && path.Base(pos.file) == f) {
+			return true
+		}
+	}
+	return false
+}
+
+// enter is called as a proc starts running in frame f.
+func (d *Debugger) enter(proc string, args []*TclObj, f *stackframe) {
+	d.calls = append(d.calls, debugCall{proc: proc, args: args, frame: f})
+	if !d.stopping {
+		d.mu.Lock()
+		d.entered = d.entered || d.procBreaks[proc]
+		d.mu.Unlock()
+	}
+}
+
+func (d *Debugger) leave() {
+	if len(d.calls) > 1 {
+		d.calls = d.calls[:len(d.calls)-1]
+	}
+}
+
+// before is called before each command of a script, and stops there
+// if it should.
+func (d *Debugger) before(cmd *command) TclStatus {
+	if d.stopping {
+		return kTclOK
+	}
+	d.calls[len(d.calls)-1].cmd = cmd
+	reason := ""
+	switch {
+	case d.entered || d.atBreak(cmd.pos):
+		reason = "breakpoint"
+	case d.action == DebugStepInto,
+		d.action == DebugStepOver && len(d.calls) <= d.depth,
+		d.action == DebugStepOut && len(d.calls) < d.depth:
+		reason = "step"
+	default:
+		return kTclOK
+	}
+	d.entered = false
+	d.stopping = true
+	a := d.OnStop(d, &Stop{reason, cmd.pos.file, cmd.pos.line, cmd.String()})
+	d.stopping = false
+	if a == DebugAbort {
+		d.action = DebugContinue
+		return d.i.FailStr("script aborted by debugger")
+	}
+	d.action, d.depth = a, len(d.calls)
+	return kTclOK
+}
+
+// Backtrace returns the frames of the stopped script, innermost first.
+func (d *Debugger) Backtrace() []Frame {
+	frames := make([]Frame, len(d.calls))
+	for ix, c := range d.calls {
+		f := Frame{Level: ix, Proc: c.proc, Args: c.args}
+		if c.cmd != nil {
+			f.File, f.Line, f.Command = c.cmd.pos.file, c.cmd.pos.line, c.cmd.String()
+		}
+		frames[len(frames)-1-ix] = f
+	}
+	return frames
+}
+
+func (d *Debugger) frame(level int) (*stackframe, error) {
+	if level < 0 || level >= len(d.calls) {
+		return nil, errors.New("bad level \"" + FromInt(level).AsString() + "\"")
+	}
+	return d.calls[level].frame, nil
+}
+
+// Eval evaluates script in the frame at level, without stopping in it.
+func (d *Debugger) Eval(level int, script string) (*TclObj, error) {
+	f, e := d.frame(level)
+	if e != nil {
+		return nil, e
+	}
+	i := d.i
+	saved, stopping := i.frame, d.stopping
+	i.frame, d.stopping = f, true
+	v, e := i.EvalString(script)
+	i.ClearError()
+	i.frame, d.stopping = saved, stopping
+	return v, e
+}
+
+// Vars returns the variables in the frame at level, sorted by name.
+func (d *Debugger) Vars(level int) ([]Var, error) {
+	f, e := d.frame(level)
+	if e != nil {
+		return nil, e
+	}
+	var vars []Var
+	for _, n := range f.names() {
+		_, _, v := resolveLinks(f, n, f.lookup(n))
+		switch {
+		case v == nil:
+			continue
+		case v.arrdata != nil:
+			vars = append(vars, Var{n, FromDict(v.arrdata).AsString()})
+		case v.obj != nil:
+			vars = append(vars, Var{n, v.obj.AsString()})
+		}
+	}
+	sort.Slice(vars, func(a, b int) bool { return vars[a].Name < vars[b].Name })
+	return vars, nil
+}
+
+const consoleHelp = `c        continue to the next breakpoint
+s        step into the next command
+n        step over calls to the next command
+o        step out of this proc
+bt       show the backtrace
+f LEVEL  look at the frame at LEVEL
+v        show the frame's variables
+p SCRIPT evaluate SCRIPT in the frame
+b PROC   break on entering PROC
+b FILE:LINE
+         break at LINE of FILE
+q        abort the script`
+
+// DebugConsole attaches a debugger to i that, whenever a script stops,
+// reads commands from in and writes what they show to out. Enter h
+// for a list of them.
+func (i *Interp) DebugConsole(in io.Reader, out io.Writer) *Debugger {
+	r := bufio.NewReader(in)
+	return i.Debug(func(d *Debugger, s *Stop) DebugAction {
+		level := len(d.calls) - 1
+		fmt.Fprintf(out, "%s at %s: %s\n", s.Reason, where(s.File, s.Line), s.Command)
+		for {
+			fmt.Fprint(out, "(debug) ")
+			ln, e := r.ReadString('\n')
+			if e != nil && ln == "" {
+				return DebugAbort
+			}
+			cmd, arg, _ := strings.Cut(strings.TrimSpace(ln), " ")
+			arg = strings.TrimSpace(arg)
+			switch cmd {
+			case "c":
+				return DebugContinue
+			case "s":
+				return DebugStepInto
+			case "n":
+				return DebugStepOver
+			case "o":
+				return DebugStepOut
+			case "q":
+				return DebugAbort
+			case "bt":
+				for _, f := range d.Backtrace() {
+					mark := " "
+					if f.Level == level {
+						mark = "*"
+					}
+					call := "global"
+					if f.Proc != "" {
+						call = fromList(append([]*TclObj{FromStr(f.Proc)}, f.Args...)).AsString()
+					}
+					fmt.Fprintf(out, "%s#%d %s at %s\n", mark, f.Level, call, where(f.File, f.Line))
+				}
+			case "f":
+				n, e := strconv.Atoi(arg)
+				if _, fe := d.frame(n); e != nil || fe != nil {
+					fmt.Fprintf(out, "bad level %q\n", arg)
+					continue
+				}
+				level = n
+			case "v":
+				vars, _ := d.Vars(level)
+				for _, v := range vars {
+					fmt.Fprintf(out, "%s = %s\n", v.Name, v.Value)
+				}
+			case "p":
+				v, e := d.Eval(level, arg)
+				if e != nil {
+					fmt.Fprintln(out, "Error: "+e.Error())
+				} else {
+					fmt.Fprintln(out, v.AsString())
+				}
+			case "b":
+				file, line, ok := strings.Cut(arg, ":")
+				if n, e := strconv.Atoi(line); ok && e == nil {
+					d.BreakLine(file, n)
+				} else if arg != "" {
+					d.BreakProc(arg)
+				}
+			case "":
+			default:
+				fmt.Fprintln(out, consoleHelp)
+			}
+		}
+	})
+}
+
+func where(file string, line int) string {
+	if file == "" {
+		file = "<script>"
+	}
+	return file + ":" + strconv.Itoa(line)
+}
@@ -0,0 +1,218 @@
+package gotcl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const debugProg = `proc add {a b} {
+    set s [expr {$a + $b}]
+    return $s
+}
+proc twice {x} {
+    set y [add $x $x]
+    return $y
+}
+set r [twice 5]
+puts $r
+`
+
+func writeProg(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "prog.tcl")
+	if e := os.WriteFile(name, []byte(debugProg), 0666); e != nil {
+		t.Fatal(e)
+	}
+	return name
+}
+
+func TestDebugger(t *testing.T) {
+	name := writeProg(t)
+	i := NewInterp()
+	i.chans["stdout"] = io.Discard
+	var stops []string
+	actions := []DebugAction{DebugStepOut, DebugStepOver, DebugContinue}
+	d := i.Debug(func(d *Debugger, s *Stop) DebugAction {
+		file := s.File
+		if file != "" {
+			file = filepath.Base(file)
+		}
+		stops = append(stops, s.Reason+" "+where(file, s.Line))
+		if len(stops) == 1 && s.Reason == "breakpoint" {
+			var bt []string
+			for _, f := range d.Backtrace() {
+				bt = append(bt, f.Proc+" "+fromList(f.Args).AsString()+" "+FromInt(f.Line).AsString())
+			}
+			if got := strings.Join(bt, "|"); got != "add 5 5 2|twice 5 6|  9" {
+				t.Errorf("backtrace: got %q", got)
+			}
+			if v, e := d.Eval(2, "expr {$a * 10}"); e != nil || v.AsString() != "50" {
+				t.Errorf("eval: got %v, %v", v, e)
+			}
+			if vars, _ := d.Vars(1); len(vars) != 1 || vars[0] != (Var{"x", "5"}) {
+				t.Errorf("vars: got %v", vars)
+			}
+		}
+		a := actions[0]
+		actions = actions[1:]
+		return a
+	})
+	d.BreakProc("add")
+	if _, e := i.EvalString("source " + name); e != nil {
+		t.Fatal(e)
+	}
+	if got := strings.Join(stops, ", "); got != "breakpoint prog.tcl:2, step prog.tcl:7, step prog.tcl:10" {
+		t.Errorf("stops: got %q", got)
+	}
+
+	stops = nil
+	actions = []DebugAction{DebugContinue, DebugStepInto, DebugAbort}
+	d.ClearProcBreaks()
+	d.BreakLine("prog.tcl", 6)
+	d.Step(DebugStepInto)
+	if _, e := i.EvalString("source " + name); e == nil || e.Error() != "script aborted by debugger" {
+		t.Errorf("abort: got %v", e)
+	}
+	if got := strings.Join(stops, ", "); got != "step <script>:1, breakpoint prog.tcl:6, step prog.tcl:2" {
+		t.Errorf("stops: got %q", got)
+	}
+	d.Detach()
+	if v, e := i.EvalString("twice 2"); e != nil || v.AsString() != "4" {
+		t.Errorf("detached: got %v, %v", v, e)
+	}
+}
+
+func TestDebugConsole(t *testing.T) {
+	i := NewInterp()
+	var out strings.Builder
+	d := i.DebugConsole(strings.NewReader("bt\np set x\nf 0\nv\nc\n"), &out)
+	d.BreakProc("twice")
+	if _, e := i.EvalString("proc twice {x} {\n  expr {$x * 2}\n}\nset g 1\ntwice 3"); e != nil {
+		t.Fatal(e)
+	}
+	want := `breakpoint at <script>:2: expr {$x * 2}
+(debug) *#1 twice 3 at <script>:2
+ #0 global at <script>:5
+(debug) 3
+(debug) (debug) g = 1
+(debug) `
+	if got := out.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestServeDAP(t *testing.T) {
+	name := writeProg(t)
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	served := make(chan error)
+	go func() {
+		served <- ServeDAP(NewInterp(), sr, sw)
+		sw.Close()
+	}()
+	in := bufio.NewReader(cr)
+	seq := 0
+	send := func(cmd string, args jsonObj) {
+		seq++
+		data, _ := json.Marshal(jsonObj{"seq": seq, "type": "request", "command": cmd, "arguments": args})
+		io.WriteString(cw, "Content-Length: "+FromInt(len(data)).AsString()+"\r\n\r\n"+string(data))
+	}
+	type message struct {
+		Type, Command, Event, Message string
+		Success                       bool
+		Body                          json.RawMessage
+	}
+	// await reads messages until a kind of message, a response or an
+	// event, with the name given, returning its body.
+	var output string
+	await := func(kind, name string) json.RawMessage {
+		t.Helper()
+		for {
+			var m message
+			if e := readDAP(in, &m); e != nil {
+				t.Fatal(e)
+			}
+			if m.Event == "output" {
+				var o struct{ Output string }
+				json.Unmarshal(m.Body, &o)
+				output += o.Output
+			}
+			if m.Type == "response" && !m.Success {
+				t.Fatalf("%s: %s", m.Command, m.Message)
+			}
+			if m.Type == kind && (m.Command == name || m.Event == name) {
+				return m.Body
+			}
+		}
+	}
+
+	send("initialize", nil)
+	await("event", "initialized")
+	send("launch", jsonObj{"program": name})
+	await("response", "launch")
+	send("setFunctionBreakpoints", jsonObj{"breakpoints": []jsonObj{{"name": "add"}}})
+	await("response", "setFunctionBreakpoints")
+	send("configurationDone", nil)
+	await("event", "stopped")
+	send("stackTrace", jsonObj{"threadId": 1})
+	var st struct {
+		StackFrames []struct {
+			ID   int
+			Name string
+			Line int
+		}
+	}
+	json.Unmarshal(await("response", "stackTrace"), &st)
+	if len(st.StackFrames) != 3 || st.StackFrames[0].Name != "add 5 5" || st.StackFrames[1].Line != 6 {
+		t.Errorf("stackTrace: got %+v", st.StackFrames)
+	}
+	send("evaluate", jsonObj{"expression": "set x", "frameId": st.StackFrames[1].ID})
+	var ev struct{ Result string }
+	json.Unmarshal(await("response", "evaluate"), &ev)
+	if ev.Result != "5" {
+		t.Errorf("evaluate: got %q", ev.Result)
+	}
+	send("continue", jsonObj{"threadId": 1})
+	await("event", "terminated")
+	if output != "10\n" {
+		t.Errorf("output: got %q", output)
+	}
+	send("disconnect", nil)
+	await("response", "disconnect")
+	if e := <-served; e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestServeDAPAbortRunning(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "loop.tcl")
+	if e := os.WriteFile(name, []byte("while 1 {}\n"), 0666); e != nil {
+		t.Fatal(e)
+	}
+	var reqs strings.Builder
+	for seq, cmd := range []string{"initialize", "launch", "configurationDone", "disconnect"} {
+		args := jsonObj{}
+		if cmd == "launch" {
+			args["program"] = name
+		}
+		data, _ := json.Marshal(jsonObj{"seq": seq + 1, "type": "request", "command": cmd, "arguments": args})
+		reqs.WriteString("Content-Length: " + FromInt(len(data)).AsString() + "\r\n\r\n" + string(data))
+	}
+	served := make(chan error)
+	go func() {
+		served <- ServeDAP(NewInterp(), strings.NewReader(reqs.String()), io.Discard)
+	}()
+	select {
+	case e := <-served:
+		if e != nil {
+			t.Fatal(e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("disconnect didn't abort the running script")
+	}
+}
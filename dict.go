@@ -0,0 +1,704 @@
+package gotcl
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A dict maps keys to values, remembering the order keys were added in.
+// It isn't changed once made, since objects holding it may be shared.
+// Instead, each change adds an entry to the end of a table of entries
+// that dicts share, and makes a new dict of the table up to there, as
+// long as no other dict has added to it yet; otherwise the change
+// copies the dict. So a dict built up in a loop takes amortized
+// constant time per change.
+type dict struct {
+	tab  *dictTab
+	n    int // the entries of tab that make up the dict
+	live int // the number of keys
+	// Set while no dict has added to tab past n.
+	tailFree atomic.Bool
+}
+
+// A dictTab holds the entries of dicts. Entries are only ever added,
+// by the one dict allowed to, while others may be reading it.
+type dictTab struct {
+	mu    sync.RWMutex
+	ents  []dictEnt
+	index map[string]int // each key's last entry
+}
+
+type dictEnt struct {
+	key, val *TclObj // val is nil where the key was removed
+	prev     int     // the key's entry before this one, or -1
+	at       int     // the entry giving the key its place in the order
+}
+
+func newDict(n int) *dict {
+	d := &dict{tab: &dictTab{
+		ents:  make([]dictEnt, 0, n),
+		index: make(map[string]int, n),
+	}}
+	d.tailFree.Store(true)
+	return d
+}
+
+func (d *dict) size() int { return d.live }
+
+// find returns the entry setting k in d, or -1 if k isn't in d. The
+// caller holds d.tab.mu.
+func (d *dict) find(k string) int {
+	ix, ok := d.tab.index[k]
+	if !ok {
+		return -1
+	}
+	for ix >= d.n {
+		ix = d.tab.ents[ix].prev
+	}
+	if ix < 0 || d.tab.ents[ix].val == nil {
+		return -1
+	}
+	return ix
+}
+
+func (d *dict) get(k string) (*TclObj, bool) {
+	d.tab.mu.RLock()
+	defer d.tab.mu.RUnlock()
+	if ix := d.find(k); ix >= 0 {
+		return d.tab.ents[ix].val, true
+	}
+	return nil, false
+}
+
+// put sets k to v in d, or removes k if v is nil. d must not be shared
+// yet, and must be the dict allowed to add to its table.
+func (d *dict) put(k, v *TclObj) {
+	s := k.AsString()
+	t := d.tab
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := d.find(s)
+	if old < 0 && v == nil {
+		return
+	}
+	e := dictEnt{key: k, val: v, prev: -1, at: len(t.ents)}
+	if last, ok := t.index[s]; ok {
+		e.prev = last
+	}
+	switch {
+	case old < 0:
+		d.live++
+	case v == nil:
+		d.live--
+	default:
+		e.at = t.ents[old].at
+	}
+	t.index[s] = len(t.ents)
+	t.ents = append(t.ents, e)
+	d.n++
+}
+
+// next returns a dict equal to d to make a change in. It adds to d's
+// table if d may, and copies d otherwise, or once the table has more
+// replaced entries than live ones.
+func (d *dict) next() *dict {
+	if d.n <= 2*d.live+8 && d.tailFree.CompareAndSwap(true, false) {
+		c := &dict{tab: d.tab, n: d.n, live: d.live}
+		c.tailFree.Store(true)
+		return c
+	}
+	return d.copy()
+}
+
+func (d *dict) copy() *dict {
+	keys, vals := d.items()
+	c := newDict(len(keys) + 1)
+	for ix, k := range keys {
+		c.put(k, vals[ix])
+	}
+	return c
+}
+
+// with returns d with k set to v.
+func (d *dict) with(k, v *TclObj) *dict {
+	c := d.next()
+	c.put(k, v)
+	return c
+}
+
+// without returns d without the keys in ks.
+func (d *dict) without(ks ...*TclObj) *dict {
+	c := d.next()
+	for _, k := range ks {
+		c.put(k, nil)
+	}
+	return c
+}
+
+// items returns the keys of d, in order, and their values.
+func (d *dict) items() (keys, vals []*TclObj) {
+	t := d.tab
+	t.mu.RLock()
+	// The first n entries never change, so can be read unlocked.
+	ents := t.ents[:d.n]
+	t.mu.RUnlock()
+	keys = make([]*TclObj, 0, d.live)
+	vals = make([]*TclObj, 0, d.live)
+	for ix, e := range ents {
+		if d.n == d.live {
+			// Nothing's been replaced or removed.
+			keys, vals = append(keys, e.key), append(vals, e.val)
+			continue
+		}
+		if e.at != ix {
+			continue
+		}
+		s := e.key.AsString()
+		t.mu.RLock()
+		last := d.find(s)
+		t.mu.RUnlock()
+		if last >= 0 && ents[last].at == ix {
+			keys, vals = append(keys, e.key), append(vals, ents[last].val)
+		}
+	}
+	return keys, vals
+}
+
+func (d *dict) list() []*TclObj {
+	keys, vals := d.items()
+	l := make([]*TclObj, 0, 2*len(keys))
+	for ix, k := range keys {
+		l = append(l, k, vals[ix])
+	}
+	return l
+}
+
+func fromDict(d *dict) *TclObj {
+	t := new(TclObj)
+	t.ownReps().dictval.Store(d)
+	return t
+}
+
+// asDict returns t as a dict, which it can be if it's a list of keys and
+// values.
+func (t *TclObj) asDict() (*dict, error) {
+	if d := t.reps().dictval.Load(); d != nil {
+		return d, nil
+	}
+	l, e := t.AsList()
+	if e != nil {
+		return nil, e
+	}
+	if len(l)%2 != 0 {
+		return nil, errors.New("missing value to go with key")
+	}
+	d := newDict(len(l) / 2)
+	for ix := 0; ix < len(l); ix += 2 {
+		d.put(l[ix], l[ix+1])
+	}
+	t.ownReps().dictval.Store(d)
+	return d, nil
+}
+
+func keyNotKnown(k *TclObj) error {
+	return errors.New("key \"" + k.AsString() + "\" not known in dictionary")
+}
+
+// dictGet returns the value at path in the dict v and those nested in it.
+func dictGet(v *TclObj, path []*TclObj) (*TclObj, error) {
+	for _, k := range path {
+		d, e := v.asDict()
+		if e != nil {
+			return nil, e
+		}
+		var ok bool
+		if v, ok = d.get(k.AsString()); !ok {
+			return nil, keyNotKnown(k)
+		}
+	}
+	return v, nil
+}
+
+// dictSet returns d, which may be nil, with the value at path in it and
+// those nested in it set to v, or removed if v is nil.
+func dictSet(d *TclObj, path []*TclObj, v *TclObj) (*TclObj, error) {
+	dv := newDict(0)
+	if d != nil {
+		var e error
+		if dv, e = d.asDict(); e != nil {
+			return nil, e
+		}
+	}
+	k := path[0]
+	if len(path) > 1 {
+		inner, ok := dv.get(k.AsString())
+		if !ok {
+			if v == nil {
+				return nil, keyNotKnown(k)
+			}
+			inner = nil
+		}
+		var e error
+		if v, e = dictSet(inner, path[1:], v); e != nil {
+			return nil, e
+		}
+	} else if v == nil {
+		return fromDict(dv.without(k)), nil
+	}
+	return fromDict(dv.with(k, v)), nil
+}
+
+// dictVar returns the dict in the variable named by t. If there's no
+// such variable, it returns an empty one if create is set, and fails
+// otherwise.
+func (i *Interp) dictVar(t *TclObj, create bool) (*TclObj, *dict, TclStatus) {
+	v, e := i.getVar(t.asVarRef())
+	if e != nil {
+		if !create {
+			return nil, nil, i.FailStr("can't read \"" + t.AsString() + "\": no such variable")
+		}
+		v = fromDict(newDict(0))
+	}
+	d, e := v.asDict()
+	if e != nil {
+		return nil, nil, i.Fail(e)
+	}
+	return v, d, kTclOK
+}
+
+func dictCreate(i *Interp, args []*TclObj) TclStatus {
+	if len(args)%2 != 0 {
+		return i.FailStr("wrong # args: should be \"dict create ?key value ...?\"")
+	}
+	d := newDict(len(args) / 2)
+	for ix := 0; ix < len(args); ix += 2 {
+		d.put(args[ix], args[ix+1])
+	}
+	return i.Return(fromDict(d))
+}
+
+func dictGetCmd(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"dict get dictionary ?key ...?\"")
+	}
+	v, e := dictGet(args[0], args[1:])
+	if e != nil {
+		return i.Fail(e)
+	}
+	if len(args) == 1 {
+		// The dict itself, checking that it is one.
+		if _, e := v.asDict(); e != nil {
+			return i.Fail(e)
+		}
+	}
+	return i.Return(v)
+}
+
+func dictSetCmd(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 3 {
+		return i.FailStr("wrong # args: should be \"dict set dictVarName key ?key ...? value\"")
+	}
+	d, _, rc := i.dictVar(args[0], true)
+	if rc != kTclOK {
+		return rc
+	}
+	nd, e := dictSet(d, args[1:len(args)-1], args[len(args)-1])
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.setVar(args[0].asVarRef(), nd)
+}
+
+func dictUnset(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"dict unset dictVarName key ?key ...?\"")
+	}
+	d, _, rc := i.dictVar(args[0], true)
+	if rc != kTclOK {
+		return rc
+	}
+	nd, e := dictSet(d, args[1:], nil)
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.setVar(args[0].asVarRef(), nd)
+}
+
+func dictExists(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"dict exists dictionary key ?key ...?\"")
+	}
+	_, e := dictGet(args[0], args[1:])
+	return i.Return(FromBool(e == nil))
+}
+
+// dictPick makes dict keys or dict values, which return the keys or
+// values of a dict matching a pattern.
+func dictPick(cmd string, values bool) func(*Interp, []*TclObj) TclStatus {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		if len(args) != 1 && len(args) != 2 {
+			return i.FailStr("wrong # args: should be \"dict " + cmd + " dictionary ?globPattern?\"")
+		}
+		d, e := args[0].asDict()
+		if e != nil {
+			return i.Fail(e)
+		}
+		from, vals := d.items()
+		if values {
+			from = vals
+		}
+		var res []*TclObj
+		for _, v := range from {
+			if len(args) == 1 || GlobMatch(args[1].AsString(), v.AsString()) {
+				res = append(res, v)
+			}
+		}
+		return i.Return(fromList(res))
+	}
+}
+
+func dictSize(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"dict size dictionary\"")
+	}
+	d, e := args[0].asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(FromInt(d.size()))
+}
+
+// dictUpdateKey makes the dict subcommands that change the value of a
+// key in a dict variable with update, given the value, or nil if the key
+// isn't set, and the rest of the arguments.
+func dictUpdateKey(cmd, usage string, update func(i *Interp, v *TclObj, args []*TclObj) (*TclObj, TclStatus)) func(*Interp, []*TclObj) TclStatus {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		if len(args) < 2 {
+			return i.FailStr("wrong # args: should be \"dict " + cmd + " dictVarName key " + usage + "\"")
+		}
+		_, d, rc := i.dictVar(args[0], true)
+		if rc != kTclOK {
+			return rc
+		}
+		v, _ := d.get(args[1].AsString())
+		if v, rc = update(i, v, args[2:]); rc != kTclOK {
+			return rc
+		}
+		return i.setVar(args[0].asVarRef(), fromDict(d.with(args[1], v)))
+	}
+}
+
+var dictAppend = dictUpdateKey("append", "?value ...?", func(i *Interp, v *TclObj, args []*TclObj) (*TclObj, TclStatus) {
+	var sb strings.Builder
+	if v != nil {
+		sb.WriteString(v.AsString())
+	}
+	for _, a := range args {
+		sb.WriteString(a.AsString())
+	}
+	return FromStr(sb.String()), kTclOK
+})
+
+var dictLappend = dictUpdateKey("lappend", "?value ...?", func(i *Interp, v *TclObj, args []*TclObj) (*TclObj, TclStatus) {
+	var l []*TclObj
+	if v != nil {
+		var e error
+		if l, e = v.AsList(); e != nil {
+			return nil, i.Fail(e)
+		}
+	}
+	return fromList(append(append([]*TclObj(nil), l...), args...)), kTclOK
+})
+
+var dictIncr = dictUpdateKey("incr", "?increment?", func(i *Interp, v *TclObj, args []*TclObj) (*TclObj, TclStatus) {
+	if len(args) > 1 {
+		return nil, i.FailStr("wrong # args: should be \"dict incr dictVarName key ?increment?\"")
+	}
+	by, n := int64(1), int64(0)
+	var e error
+	if len(args) == 1 {
+		if by, e = args[0].AsInt64(); e != nil {
+			return nil, i.Fail(e)
+		}
+	}
+	if v != nil {
+		if n, e = v.AsInt64(); e != nil {
+			return nil, i.Fail(e)
+		}
+	}
+	return FromInt64(n + by), kTclOK
+})
+
+func dictMerge(i *Interp, args []*TclObj) TclStatus {
+	res := newDict(0)
+	for _, a := range args {
+		d, e := a.asDict()
+		if e != nil {
+			return i.Fail(e)
+		}
+		keys, vals := d.items()
+		for ix, k := range keys {
+			res.put(k, vals[ix])
+		}
+	}
+	return i.Return(fromDict(res))
+}
+
+func dictRemove(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"dict remove dictionary ?key ...?\"")
+	}
+	d, e := args[0].asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(fromDict(d.without(args[1:]...)))
+}
+
+func dictReplace(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 || len(args)%2 == 0 {
+		return i.FailStr("wrong # args: should be \"dict replace dictionary ?key value ...?\"")
+	}
+	d, e := args[0].asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	d = d.next()
+	for ix := 1; ix < len(args); ix += 2 {
+		d.put(args[ix], args[ix+1])
+	}
+	return i.Return(fromDict(d))
+}
+
+// dictLoopVars returns the key and value variables dict for, map and
+// filter script are given.
+func (i *Interp) dictLoopVars(t *TclObj) (varRef, varRef, TclStatus) {
+	l, e := t.AsList()
+	if e != nil {
+		return varRef{}, varRef{}, i.Fail(e)
+	}
+	if len(l) != 2 {
+		return varRef{}, varRef{}, i.FailStr("must have exactly two variable names")
+	}
+	return l[0].asVarRef(), l[1].asVarRef(), kTclOK
+}
+
+// dictLoop runs body once for each key and value of d, with them in the
+// variables named by vars, calling each with the result of each run that
+// finishes normally. An error from each fails the loop.
+func (i *Interp) dictLoop(vars, d, body *TclObj, each func(k, v, res *TclObj) error) TclStatus {
+	kv, vv, rc := i.dictLoopVars(vars)
+	if rc != kTclOK {
+		return rc
+	}
+	dv, e := d.asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	keys, vals := dv.items()
+	for ix, k := range keys {
+		if i.limits != nil && i.checkLimits(false) != kTclOK {
+			return kTclErr
+		}
+		if rc := i.setVar(kv, k); rc != kTclOK {
+			return rc
+		}
+		if rc := i.setVar(vv, vals[ix]); rc != kTclOK {
+			return rc
+		}
+		rc := i.EvalObj(body)
+		if rc == kTclBreak {
+			break
+		} else if rc == kTclOK {
+			if e := each(k, vals[ix], i.retval); e != nil {
+				return i.Fail(e)
+			}
+		} else if rc != kTclContinue {
+			return rc
+		}
+	}
+	return kTclOK
+}
+
+func dictFor(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 3 {
+		return i.FailStr("wrong # args: should be \"dict for {keyVarName valueVarName} dictionary script\"")
+	}
+	if rc := i.dictLoop(args[0], args[1], args[2], func(k, v, res *TclObj) error { return nil }); rc != kTclOK {
+		return rc
+	}
+	return i.Return(kNil)
+}
+
+func dictMap(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 3 {
+		return i.FailStr("wrong # args: should be \"dict map {keyVarName valueVarName} dictionary script\"")
+	}
+	res := newDict(0)
+	rc := i.dictLoop(args[0], args[1], args[2], func(k, v, r *TclObj) error {
+		res.put(k, r)
+		return nil
+	})
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(fromDict(res))
+}
+
+func dictFilter(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"dict filter dictionary filterType ?arg ...?\"")
+	}
+	d, e := args[0].asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	res := newDict(0)
+	switch ft := args[1].AsString(); ft {
+	case "key", "value":
+		keys, vals := d.items()
+		for ix, k := range keys {
+			s := k.AsString()
+			if ft == "value" {
+				s = vals[ix].AsString()
+			}
+			for _, p := range args[2:] {
+				if GlobMatch(p.AsString(), s) {
+					res.put(k, vals[ix])
+					break
+				}
+			}
+		}
+	case "script":
+		if len(args) != 4 {
+			return i.FailStr("wrong # args: should be \"dict filter dictionary script {keyVarName valueVarName} filterScript\"")
+		}
+		rc := i.dictLoop(args[2], args[0], args[3], func(k, v, r *TclObj) error {
+			keep, e := r.asBoolStrict()
+			if keep {
+				res.put(k, v)
+			}
+			return e
+		})
+		if rc != kTclOK {
+			return rc
+		}
+	default:
+		return i.FailStr("bad filterType \"" + ft + "\": must be key, script, or value")
+	}
+	return i.Return(fromDict(res))
+}
+
+// dictBind sets a variable named by each of names to the value of the
+// matching key of d, or unsets it if there's no such key, runs body,
+// then sets each key to the variable's value, or removes it if the
+// variable's gone, in the dict at path in the variable dv.
+func (i *Interp) dictBind(dv *TclObj, path []*TclObj, keys []*TclObj, names []varRef, body *TclObj) TclStatus {
+	v, _, rc := i.dictVar(dv, false)
+	if rc != kTclOK {
+		return rc
+	}
+	v, e := dictGet(v, path)
+	if e != nil {
+		return i.Fail(e)
+	}
+	d, e := v.asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	if keys == nil {
+		keys, _ = d.items()
+		for _, k := range keys {
+			names = append(names, k.asVarRef())
+		}
+	}
+	for ix, k := range keys {
+		if val, ok := d.get(k.AsString()); ok {
+			if rc := i.setVar(names[ix], val); rc != kTclOK {
+				return rc
+			}
+		} else {
+			i.setVar(names[ix], nil)
+		}
+	}
+	// The variables are written back however the body finishes, and the
+	// dict variable may itself have been changed by it.
+	rc = i.EvalObj(body)
+	res := i.retval
+	outer, _, wrc := i.dictVar(dv, false)
+	if wrc != kTclOK {
+		return wrc
+	}
+	inner, e := dictGet(outer, path)
+	if e != nil {
+		return i.Fail(e)
+	}
+	nd, e := inner.asDict()
+	if e != nil {
+		return i.Fail(e)
+	}
+	nd = nd.next()
+	for ix, k := range keys {
+		val, _ := i.getVar(names[ix])
+		nd.put(k, val)
+	}
+	updated := fromDict(nd)
+	if len(path) > 0 {
+		if updated, e = dictSet(outer, path, updated); e != nil {
+			return i.Fail(e)
+		}
+	}
+	if wrc := i.setVar(dv.asVarRef(), updated); wrc != kTclOK {
+		return wrc
+	}
+	i.retval = res
+	return rc
+}
+
+func dictWith(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"dict with dictVarName ?key ...? script\"")
+	}
+	return i.dictBind(args[0], args[1:len(args)-1], nil, nil, args[len(args)-1])
+}
+
+func dictUpdate(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return i.FailStr("wrong # args: should be \"dict update dictVarName key varName ?key varName ...? script\"")
+	}
+	var keys []*TclObj
+	var names []varRef
+	for ix := 1; ix < len(args)-1; ix += 2 {
+		keys = append(keys, args[ix])
+		names = append(names, args[ix+1].asVarRef())
+	}
+	return i.dictBind(args[0], nil, keys, names, args[len(args)-1])
+}
+
+var dictEn = ensembleSpec{
+	"append":  dictAppend,
+	"create":  dictCreate,
+	"exists":  dictExists,
+	"filter":  dictFilter,
+	"for":     dictFor,
+	"get":     dictGetCmd,
+	"incr":    dictIncr,
+	"keys":    dictPick("keys", false),
+	"lappend": dictLappend,
+	"map":     dictMap,
+	"merge":   dictMerge,
+	"remove":  dictRemove,
+	"replace": dictReplace,
+	"set":     dictSetCmd,
+	"size":    dictSize,
+	"unset":   dictUnset,
+	"update":  dictUpdate,
+	"values":  dictPick("values", true),
+	"with":    dictWith,
+}
+
+func init() {
+	RegisterDefaultCmd("dict", dictEn.makeCmd())
+}
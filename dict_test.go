@@ -0,0 +1,40 @@
+package gotcl
+
+import "testing"
+
+func TestDictErrors(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"dict create a", `wrong # args: should be "dict create ?key value ...?"`},
+		{"dict get {a 1} b", `key "b" not known in dictionary`},
+		{"dict get {a 1 b}", "missing value to go with key"},
+		{"dict size {a}", "missing value to go with key"},
+		{"set d {a 1}\ndict unset d x y", `key "x" not known in dictionary`},
+		{"dict filter {a 1} bogus", `bad filterType "bogus": must be key, script, or value`},
+		{"dict for {k} {a 1} {}", "must have exactly two variable names"},
+		{"set d {a x}\ndict incr d a", `expected integer but got "x"`},
+		{"dict filter {a 1} script {k v} {list x y}", `expected boolean value but got "x y"`},
+		{"dict with nosuch {}", `can't read "nosuch": no such variable`},
+		{"dict update nosuch a b {}", `can't read "nosuch": no such variable`},
+		{"dict unset nosuch a b", `key "a" not known in dictionary`},
+		{"dict update d a {}", `wrong # args: should be "dict update dictVarName key varName ?key varName ...? script"`},
+	})
+}
+
+func TestDictOrder(t *testing.T) {
+	d := newDict(0)
+	for _, k := range []string{"z", "a", "m", "a"} {
+		d.put(FromStr(k), FromStr(k+k))
+	}
+	obj := fromDict(d.without(FromStr("m")))
+	if s := obj.AsString(); s != "z zz a aa" {
+		t.Errorf("got %q", s)
+	}
+	l, e := obj.AsList()
+	if e != nil || len(l) != 4 {
+		t.Fatalf("AsList = %v, %v", l, e)
+	}
+	back, e := FromStr(obj.AsString()).asDict()
+	if e != nil || back.size() != 2 || back.list()[0].AsString() != "z" {
+		t.Errorf("round trip = %v, %v", back, e)
+	}
+}
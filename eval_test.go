@@ -117,3 +117,146 @@ proc sum {lst} {
 }`
 	runCmd(code, "sum [iota 10000]", b)
 }
+
+func Benchmark_ProcCall(b *testing.B) {
+	code := `
+proc id {x} {
+    return $x
+}
+proc calls {n} {
+    for {set i 0} {$i < $n} {incr i} {
+        id $i
+    }
+}`
+	runCmd(code, "calls 1000", b)
+}
+
+func Benchmark_BuiltinCall(b *testing.B) {
+	code := `
+proc lengths {l n} {
+    for {set i 0} {$i < $n} {incr i} {
+        llength $l
+    }
+}`
+	runCmd(code, "lengths {a b c} 1000", b)
+}
+
+func TestCallSiteCache(t *testing.T) {
+	a, b := NewInterp(), NewInterp()
+	RunString(a, "proc f {} { return a }")
+	RunString(b, "proc f {} { return b }")
+	call := FromStr("f")
+	for _, want := range []string{"a", "a"} {
+		if a.EvalObj(call); a.retval.AsString() != want {
+			t.Fatalf("got %v, want %v", a.retval, want)
+		}
+	}
+	if b.EvalObj(call); b.retval.AsString() != "b" {
+		t.Fatalf("call site shared between interps: got %v", b.retval)
+	}
+	RunString(a, "rename f g; proc f {} { return c }")
+	if a.EvalObj(call); a.retval.AsString() != "c" {
+		t.Fatalf("stale command after redefinition: got %v", a.retval)
+	}
+}
+
+func TestRedefineInlined(t *testing.T) {
+	i := NewInterp()
+	RunString(i, `
+proc probe {} {
+    set x 1
+    proc set {args} { return 99 }
+    rename incr {}
+    proc incr {args} { return 42 }
+    list [set x 2] [incr x]
+}
+proc other {} {
+    if {1} { expr {1 + 2} }
+}`)
+	if v, e := i.EvalString("probe"); e != nil || v.AsString() != "99 42" {
+		t.Fatalf("probe = %v, %v", v, e)
+	}
+	// Builtins that weren't redefined still run compiled.
+	if v, e := i.EvalString("other"); e != nil || v.AsString() != "3" {
+		t.Fatalf("other = %v, %v", v, e)
+	}
+	if i.replaced["if"] || !i.replaced["incr"] {
+		t.Errorf("replaced = %v", i.replaced)
+	}
+}
+
+func TestApplyCachesLambda(t *testing.T) {
+	i := NewInterp()
+	lambda := FromStr("{x} {expr {$x * 2}}")
+	i.SetVarRaw("f", lambda)
+	var first *TclCmd
+	for _, test := range []struct{ script, want string }{{"apply $f 3", "6"}, {"apply $f 4", "8"}} {
+		if v, e := i.EvalString(test.script); e != nil || v.AsString() != test.want {
+			t.Fatalf("%s = %v, %v", test.script, v, e)
+		}
+		if p := lambda.reps().procval.Load(); first == nil {
+			first = p
+		} else if p != first {
+			t.Error("lambda compiled again")
+		}
+	}
+	if first == nil {
+		t.Error("lambda not cached")
+	}
+	if lambda.AsString() != "{x} {expr {$x * 2}}" {
+		t.Errorf("lambda string changed to %q", lambda.AsString())
+	}
+}
+
+func TestAppendList(t *testing.T) {
+	base, _ := FromStr("a").appendList([]*TclObj{FromStr("b")})
+	// Only the first list appended to base may take the room past it.
+	x, _ := base.appendList([]*TclObj{FromStr("x")})
+	y, _ := base.appendList([]*TclObj{FromStr("y")})
+	z, _ := x.appendList([]*TclObj{FromStr("z")})
+	for _, test := range []struct {
+		l    *TclObj
+		want string
+	}{{base, "a b"}, {x, "a b x"}, {y, "a b y"}, {z, "a b x z"}} {
+		if got := test.l.AsString(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	i := NewInterp()
+	RunString(i, `
+proc greet {who {greeting hello}} { return "$greeting, $who" }
+proc unknown {args} { return "unknown: $args" }
+proc inner {} { set x local; gocall }
+set x global
+`)
+	v, e := i.Call("greet", FromStr("a b"))
+	if e != nil || v.AsString() != "hello, a b" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	v, e = i.CallObjs([]*TclObj{FromStr("missing"), FromStr("x")})
+	if e != nil || v.AsString() != "unknown: missing x" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if _, e = i.Call("error", FromStr("boom")); e == nil || e.Error() != "boom" {
+		t.Fatalf("got %v", e)
+	}
+	if _, e = i.Call("break"); e == nil {
+		t.Fatal("break escaped Call")
+	}
+	var local, global string
+	i.SetCmd("gocall", func(i *Interp, args []*TclObj) TclStatus {
+		l, _ := i.Call("set", FromStr("x"))
+		g, _ := i.CallGlobal("set", FromStr("x"))
+		local, global = l.AsString(), g.AsString()
+		return i.Return(kNil)
+	})
+	if _, e = i.Call("inner"); e != nil {
+		t.Fatal(e)
+	}
+	if local != "local" || global != "global" {
+		t.Fatalf("got %q and %q", local, global)
+	}
+}
@@ -11,6 +11,8 @@ import (
 )
 
 var nogc = flag.Bool("nogc", false, "if true, gc is disabled")
+var debug = flag.Bool("debug", false, "if true, the script is run under the console debugger")
+var dap = flag.Bool("dap", false, "if true, serve the Debug Adapter Protocol on stdin and stdout")
 
 func RunRepl(in io.Reader, out io.Writer, fn func(string) (string, error)) {
 	inbuf := bufio.NewReader(in)
@@ -68,7 +70,21 @@ func main() {
 		println("GC disabled.")
 	}
 	args := flag.Args()
-	if len(args) == 1 {
+	if *dap {
+		if e := gotcl.ServeDAP(gotcl.NewInterp(), os.Stdin, os.Stdout); e != nil {
+			fmt.Fprintln(os.Stderr, "Error: "+e.Error())
+		}
+		return
+	}
+	if len(args) == 1 && *debug {
+		i := gotcl.NewInterp()
+		setArgs(i, args, false)
+		d := i.DebugConsole(os.Stdin, os.Stdout)
+		d.Step(gotcl.DebugStepInto)
+		if _, err := i.EvalString("source " + gotcl.FromList(args).AsString()); err != nil {
+			fmt.Println("Error: " + err.Error())
+		}
+	} else if len(args) == 1 {
 		filename := args[0]
 		file, e := os.Open(filename)
 		if e != nil {
@@ -372,7 +372,7 @@ func (p *parser) parseExprTerm() eterm {
 	if p.ch == '(' {
 		return p.parseFunc(txt)
 	}
-	return &tliteral{strval: txt}
+	return newLiteral(txt)
 }
 
 func (p *parser) parseFunc(name string) *funcNode {
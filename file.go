@@ -0,0 +1,260 @@
+package gotcl
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// joinName appends the name b to the directory a.
+func joinName(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case strings.HasSuffix(a, "/"):
+		return a + b
+	}
+	return a + "/" + b
+}
+
+// glob returns the names in i's filesystem matching pat, any component
+// of which may be a glob pattern. Relative patterns are matched in dir,
+// if it's given, and what's returned is relative to it.
+func (i *Interp) glob(dir, pat string) []string {
+	fsys := i.FS()
+	root := ""
+	if strings.HasPrefix(pat, "//") {
+		root = "//"
+	} else if strings.HasPrefix(pat, "/") {
+		root = "/"
+	}
+	full := func(n string) string {
+		if root == "" && dir != "" {
+			return joinName(dir, n)
+		}
+		if n == "" {
+			return "."
+		}
+		return n
+	}
+	names := []string{root}
+	literal := false
+	for _, part := range strings.Split(strings.TrimLeft(pat, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		var next []string
+		literal = !strings.ContainsAny(part, "*?[")
+		for _, n := range names {
+			if literal {
+				next = append(next, joinName(n, part))
+				continue
+			}
+			ents, e := fsys.ReadDir(full(n))
+			if e != nil {
+				continue
+			}
+			for _, ent := range ents {
+				name := ent.Name()
+				if (name[0] != '.' || part[0] == '.') && GlobMatch(part, name) {
+					next = append(next, joinName(n, name))
+				}
+			}
+		}
+		names = next
+	}
+	if literal {
+		// Names read from directories exist, but these might not.
+		var found []string
+		for _, n := range names {
+			if _, e := fsys.Stat(full(n)); e == nil {
+				found = append(found, n)
+			}
+		}
+		names = found
+	}
+	return names
+}
+
+func tclGlob(i *Interp, args []*TclObj) TclStatus {
+	nocomplain, tails := false, false
+	dir := ""
+opts:
+	for len(args) > 0 && strings.HasPrefix(args[0].AsString(), "-") {
+		switch args[0].AsString() {
+		case "-nocomplain":
+			nocomplain = true
+		case "-tails":
+			tails = true
+		case "-directory":
+			if len(args) < 2 {
+				return i.FailStr("missing argument to \"-directory\"")
+			}
+			dir = args[1].AsString()
+			args = args[1:]
+		case "--":
+			args = args[1:]
+			break opts
+		default:
+			return i.FailStr("bad option \"" + args[0].AsString() +
+				"\": must be -directory, -nocomplain, -tails, or --")
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"glob ?switches? name ?name ...?\"")
+	}
+	var res []string
+	pats := make([]string, len(args))
+	for ix, a := range args {
+		pats[ix] = a.AsString()
+		for _, n := range i.glob(dir, pats[ix]) {
+			if dir != "" && !tails && !strings.HasPrefix(pats[ix], "/") {
+				n = joinName(dir, n)
+			}
+			res = append(res, n)
+		}
+	}
+	if len(res) == 0 && !nocomplain {
+		if len(pats) == 1 {
+			return i.FailStr("no files matched glob pattern \"" + pats[0] + "\"")
+		}
+		return i.FailStr("no files matched glob patterns \"" + strings.Join(pats, " ") + "\"")
+	}
+	return i.Return(FromList(res))
+}
+
+// splitName returns the components of a name, the first being "/" if
+// it's absolute.
+func splitName(name string) []string {
+	var parts []string
+	if strings.HasPrefix(name, "/") {
+		parts = append(parts, "/")
+	}
+	for _, p := range strings.Split(name, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+func fileJoin(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"file join name ?name ...?\"")
+	}
+	res := ""
+	for _, a := range args {
+		for _, p := range splitName(a.AsString()) {
+			if p == "/" {
+				res = "/"
+			} else {
+				res = joinName(res, p)
+			}
+		}
+	}
+	return i.Return(FromStr(res))
+}
+
+func fileTail(name string) string {
+	parts := splitName(name)
+	if len(parts) == 0 || parts[len(parts)-1] == "/" {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+func fileDirname(name string) string {
+	parts := splitName(name)
+	switch {
+	case len(parts) == 0:
+		return "."
+	case len(parts) == 1:
+		if parts[0] == "/" {
+			return "/"
+		}
+		return "."
+	case len(parts) == 2 && parts[0] == "/":
+		return "/"
+	}
+	return strings.TrimPrefix(strings.Join(parts[:len(parts)-1], "/"), "/")
+}
+
+// fileExtension returns the extension of name's last component,
+// counting from its last dot, unless that's the first character.
+func fileExtension(name string) string {
+	tail := fileTail(name)
+	if ix := strings.LastIndex(tail, "."); ix > 0 {
+		return tail[ix:]
+	}
+	return ""
+}
+
+func fileRootname(name string) string {
+	return strings.TrimSuffix(name, fileExtension(name))
+}
+
+// stat returns what i's filesystem knows of the file named by the only
+// argument, failing with Tcl's message if it can't.
+func (i *Interp) stat(cmd string, args []*TclObj) (fs.FileInfo, TclStatus) {
+	if len(args) != 1 {
+		return nil, i.FailStr("wrong # args: should be \"file " + cmd + " name\"")
+	}
+	fi, e := i.FS().Stat(args[0].AsString())
+	if e != nil {
+		msg := e.Error()
+		if errors.Is(e, fs.ErrNotExist) {
+			msg = "no such file or directory"
+		}
+		return nil, i.FailStr("could not read \"" + args[0].AsString() + "\": " + msg)
+	}
+	return fi, kTclOK
+}
+
+// fileTest makes a file subcommand reporting whether the named file
+// exists and satisfies ok.
+func fileTest(cmd string, ok func(fs.FileInfo) bool) func(*Interp, []*TclObj) TclStatus {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		if len(args) != 1 {
+			return i.FailStr("wrong # args: should be \"file " + cmd + " name\"")
+		}
+		fi, e := i.FS().Stat(args[0].AsString())
+		return i.Return(FromBool(e == nil && ok(fi)))
+	}
+}
+
+var fileEn = ensembleSpec{
+	"dirname":   fileDirname,
+	"exists":    fileTest("exists", func(fs.FileInfo) bool { return true }),
+	"extension": fileExtension,
+	"isdirectory": fileTest("isdirectory", func(fi fs.FileInfo) bool {
+		return fi.IsDir()
+	}),
+	"isfile": fileTest("isfile", func(fi fs.FileInfo) bool {
+		return fi.Mode().IsRegular()
+	}),
+	"join": fileJoin,
+	"mtime": func(i *Interp, args []*TclObj) TclStatus {
+		fi, rc := i.stat("mtime", args)
+		if rc != kTclOK {
+			return rc
+		}
+		return i.Return(FromInt64(fi.ModTime().Unix()))
+	},
+	"rootname": fileRootname,
+	"size": func(i *Interp, args []*TclObj) TclStatus {
+		fi, rc := i.stat("size", args)
+		if rc != kTclOK {
+			return rc
+		}
+		return i.Return(FromInt64(fi.Size()))
+	},
+	"split": splitName,
+	"tail":  fileTail,
+}
+
+func init() {
+	RegisterDefaultCmd("file", fileEn.makeCmd())
+	RegisterDefaultCmd("glob", tclGlob)
+	RegisterDefaultCmd("zipfs", zipfsEn.makeCmd())
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 // Simple struct for embedding in every 
@@ -23,24 +24,22 @@ func (ne notExpand) isExpand() bool {
 	return false
 }
 
+// Parsed code can be evaluated in several goroutines at once, so
+// tokens make their objects up front rather than on first use.
 type tliteral struct {
 	notExpand
 	strval string
-	tval   *TclObj // cached
+	tval   *TclObj
 }
 
-func (l *tliteral) AsTclObj() *TclObj {
-	if l.tval == nil {
-		l.tval = FromStr(l.strval)
-	}
-	return l.tval
+func newLiteral(s string) *tliteral {
+	return &tliteral{strval: s, tval: FromStr(s)}
 }
 
+func (l *tliteral) AsTclObj() *TclObj { return l.tval }
+
 func (l *tliteral) String() string { return l.strval }
 func (l *tliteral) Eval(i *Interp) TclStatus {
-	if l.tval == nil {
-		l.tval = FromStr(l.strval)
-	}
 	i.retval = l.tval
 	return kTclOK
 }
@@ -63,19 +62,15 @@ type block struct {
 	tval   *TclObj
 }
 
+func newBlock(s string) *block {
+	return &block{strval: s, tval: FromStr(s)}
+}
+
 func (b *block) String() string { return "{" + b.strval + "}" }
 
-func (b *block) AsTclObj() *TclObj {
-	if b.tval == nil {
-		b.tval = FromStr(b.strval)
-	}
-	return b.tval
-}
+func (b *block) AsTclObj() *TclObj { return b.tval }
 
 func (b *block) Eval(i *Interp) TclStatus {
-	if b.tval == nil {
-		b.tval = FromStr(b.strval)
-	}
 	return i.Return(b.tval)
 }
 
@@ -191,7 +186,7 @@ func toVarRef(s string) varRef {
 	if s[len(s)-1] == ')' {
 		ri := strings.IndexRune(s, '(')
 		if ri > 0 {
-			ind := &tliteral{strval: s[ri+1 : len(s)-1]}
+			ind := newLiteral(s[ri+1 : len(s)-1])
 			s = s[0:ri]
 			return varRef{name: s, is_global: global, arrind: ind}
 		}
@@ -209,6 +204,8 @@ type command struct {
 	words     []tclTok
 	no_expand bool
 	simple    *simpleCall
+	site      *callSite
+	pos       srcPos
 }
 
 // a simpleTok is a token that won't change.
@@ -239,7 +236,7 @@ func makeCommand(words []tclTok) command {
 		}
 		simple = &simpleCall{cmdname: args[0].AsString(), args: args[1:]}
 	}
-	return command{words: words, simple: simple, no_expand: !has_expand}
+	return command{words: words, simple: simple, no_expand: !has_expand, site: new(callSite)}
 }
 
 func (c *command) String() string {
@@ -283,15 +280,102 @@ type varEntry struct {
 	arrdata map[string]*TclObj
 }
 
+func (v *varEntry) exists() bool {
+	return v.obj != nil || v.link != nil || v.arrdata != nil
+}
+
 type varMap map[string]*varEntry
 
+// Frames of compiled procs keep the variables the compiler knows
+// about in locals, indexed by slot. Any others go in vars, which is
+// made on demand.
 type stackframe struct {
-	vars varMap
-	next *stackframe
+	vars   varMap
+	next   *stackframe
+	locals []varEntry
+	ltab   *localTable
 }
 
 func newstackframe(tail *stackframe) *stackframe {
-	return &stackframe{make(varMap), tail}
+	return &stackframe{next: tail}
+}
+
+// lookup returns the variable name in f, or nil if it doesn't exist.
+func (f *stackframe) lookup(name string) *varEntry {
+	if f.ltab != nil {
+		if ix, ok := f.ltab.index[name]; ok {
+			if v := &f.locals[ix]; v.exists() {
+				return v
+			}
+			return nil
+		}
+	}
+	return f.vars[name]
+}
+
+// create returns the variable name in f, adding it if it doesn't exist.
+func (f *stackframe) create(name string) *varEntry {
+	if f.ltab != nil {
+		if ix, ok := f.ltab.index[name]; ok {
+			return &f.locals[ix]
+		}
+	}
+	v, ok := f.vars[name]
+	if !ok {
+		if f.vars == nil {
+			f.vars = make(varMap)
+		}
+		v = &varEntry{}
+		f.vars[name] = v
+	}
+	return v
+}
+
+func (f *stackframe) remove(name string) {
+	if f.ltab != nil {
+		if ix, ok := f.ltab.index[name]; ok {
+			f.locals[ix] = varEntry{}
+			return
+		}
+	}
+	delete(f.vars, name)
+}
+
+// procFrame returns a frame for a call to a proc with locals ltab,
+// reusing one freed by an earlier call if possible.
+func (i *Interp) procFrame(ltab *localTable) *stackframe {
+	n := len(ltab.names)
+	if k := len(i.freeFrames); k > 0 {
+		f := i.freeFrames[k-1]
+		if cap(f.locals) >= n {
+			i.freeFrames = i.freeFrames[:k-1]
+			f.next, f.locals, f.ltab = i.frame, f.locals[:n], ltab
+			return f
+		}
+	}
+	return &stackframe{next: i.frame, locals: make([]varEntry, n), ltab: ltab}
+}
+
+// freeFrame makes f available for reuse once its proc has returned.
+// Nothing can still refer to it then, as upvar only links to frames
+// further up the stack.
+func (i *Interp) freeFrame(f *stackframe) {
+	clear(f.locals)
+	*f = stackframe{locals: f.locals}
+	i.freeFrames = append(i.freeFrames, f)
+}
+
+func (f *stackframe) names() []string {
+	names := make([]string, 0, len(f.vars)+len(f.locals))
+	for ix := range f.locals {
+		if f.locals[ix].exists() {
+			names = append(names, f.ltab.names[ix])
+		}
+	}
+	for n := range f.vars {
+		names = append(names, n)
+	}
+	return names
 }
 
 type Interp struct {
@@ -301,6 +385,46 @@ type Interp struct {
 	retval   *TclObj
 	err      error
 	cmdcount int
+	// The word the running command was invoked by, for its usage
+	// message, until it calls another.
+	cmdname  string
+	epoch    uint64
+	limits   *limits
+	parent   *Interp
+	children map[string]*Interp
+	hidden   map[string]TclCmd
+	aliases  map[string]*alias
+	cmdinfo  map[string]*cmdInfo
+	safe     bool
+	deleted  bool
+	stack    []*TclObj
+	// Frames of returned procs, for reuse.
+	freeFrames []*stackframe
+
+	autoLoaders []AutoLoader
+	// Commands auto_load is loading, so it doesn't recurse.
+	autoPending map[string]bool
+
+	vfs  *vfsTable
+	pkgs map[string]*pkg
+	// pkgIndex.tcl files already sourced.
+	pkgIndexed map[string]bool
+
+	// Set while a debugger is attached.
+	debug *Debugger
+	// Set while profiling, and to the last profile taken.
+	prof, profiled *Profiler
+	// Likewise for coverage.
+	cover, covered *Coverage
+
+	// The builtins compiled inline that have been redefined, whose
+	// calls compiled code must make as it would any other command's.
+	replaced map[string]bool
+
+	// Set when cmds is shared with another interp, which might be
+	// reading it from another goroutine, so it must be copied first.
+	// Clones of the interp may set it concurrently.
+	cmdsShared atomic.Bool
 }
 
 func (i *Interp) Return(val *TclObj) TclStatus {
@@ -317,67 +441,119 @@ func (i *Interp) FailStr(msg string) TclStatus {
 	return i.Fail(errors.New(msg))
 }
 
+// TclObj caches each representation it's converted to. Objects are
+// shared freely between interps, including those running in other
+// goroutines, so the caches are filled atomically. Racing conversions
+// compute the same value, so it doesn't matter which one wins.
 type TclObj struct {
-	value      *string
-	intval     int
-	has_intval bool
-	listval    []*TclObj
-	cmdsval    []command
-	vrefval    *varRef
-	exprval    eterm
+	value      atomic.Pointer[string]
+	intval     atomic.Int64
+	has_intval atomic.Bool
+	// Set while the room past the end of listval is free for one list
+	// appended to this one to take.
+	tailFree atomic.Bool
+	listval  atomic.Pointer[[]*TclObj]
+	// The rarer reps, kept apart so the many objects that are only
+	// strings, integers or lists stay small.
+	ext atomic.Pointer[objReps]
+	// For a braced word, where it was parsed.
+	src *srcPos
+}
+
+type objReps struct {
+	cmdsval  atomic.Pointer[[]command]
+	vrefval  atomic.Pointer[varRef]
+	exprval  atomic.Pointer[eterm]
+	codeval  atomic.Pointer[bytecode]
+	procval  atomic.Pointer[TclCmd]
+	custom   atomic.Pointer[customRep]
+	indexval atomic.Pointer[index]
+	dictval  atomic.Pointer[dict]
+}
+
+// noReps stands in for the reps of an object that has none yet.
+var noReps objReps
+
+// reps returns t's rarer reps for reading.
+func (t *TclObj) reps() *objReps {
+	if r := t.ext.Load(); r != nil {
+		return r
+	}
+	return &noReps
+}
+
+// ownReps returns t's rarer reps for setting one, making them if need be.
+func (t *TclObj) ownReps() *objReps {
+	r := t.ext.Load()
+	if r == nil {
+		r = new(objReps)
+		if !t.ext.CompareAndSwap(nil, r) {
+			r = t.ext.Load()
+		}
+	}
+	return r
 }
 
 func (t *TclObj) AsString() string {
-	if t.value == nil {
-		if t.has_intval {
-			v := strconv.Itoa(t.intval)
-			t.value = &v
-		} else if t.listval != nil {
-			var str bytes.Buffer
-			for ind, i := range t.listval {
-				if ind != 0 {
-					str.WriteString(" ")
-				}
-				sv := i.AsString()
-				should_bracket := strings.IndexAny(sv, " \t\n\v") != -1 || len(sv) == 0
-				if should_bracket {
-					str.WriteString("{")
-				}
-				str.WriteString(sv)
-				if should_bracket {
-					str.WriteString("}")
-				}
+	if v := t.value.Load(); v != nil {
+		return *v
+	}
+	var ss string
+	if t.has_intval.Load() {
+		ss = strconv.FormatInt(t.intval.Load(), 10)
+	} else if lp := t.listval.Load(); lp != nil {
+		var str bytes.Buffer
+		for ind, i := range *lp {
+			if ind != 0 {
+				str.WriteString(" ")
 			}
-			ss := str.String()
-			t.value = &ss
-		} else {
-			panic("unable to stringify TclObj")
+			str.WriteString(quoteElem(i.AsString()))
 		}
+		ss = str.String()
+	} else if d := t.reps().dictval.Load(); d != nil {
+		ss = fromList(d.list()).AsString()
+	} else if c := t.reps().custom.Load(); c != nil {
+		ss = c.typ.UpdateString(c.rep)
+	} else {
+		panic("unable to stringify TclObj")
 	}
-	return *t.value
+	t.value.Store(&ss)
+	return ss
 }
 
 func (t *TclObj) AsInt() (int, error) {
-	if !t.has_intval {
-		v, e := strconv.Atoi(*t.value)
+	v, e := t.AsInt64()
+	return int(v), e
+}
+
+func (t *TclObj) AsInt64() (int64, error) {
+	if !t.has_intval.Load() {
+		s := t.AsString()
+		v, e := strconv.ParseInt(s, 10, 64)
 		if e != nil {
-			return 0, errors.New("expected integer but got \"" + *t.value + "\"")
+			return 0, errors.New("expected integer but got \"" + s + "\"")
 		}
-		t.has_intval = true
-		t.intval = v
+		t.intval.Store(v)
+		t.has_intval.Store(true)
+		return v, nil
 	}
-	return t.intval, nil
+	return t.intval.Load(), nil
 }
 
 func (t *TclObj) asCmds() ([]command, error) {
-	if t.cmdsval == nil {
-		c, e := parseCommands(strings.NewReader(t.AsString()))
-		if e != nil {
-			return nil, e
-		}
-		t.cmdsval = c
+	if c := t.reps().cmdsval.Load(); c != nil {
+		return *c, nil
+	}
+	pos := srcPos{line: 1}
+	if t.src != nil {
+		pos = *t.src
+	}
+	c, e := parseCommandsAt(strings.NewReader(t.AsString()), pos)
+	if e != nil {
+		return nil, e
 	}
-	return t.cmdsval, nil
+	t.ownReps().cmdsval.Store(&c)
+	return c, nil
 }
 
 func (t *TclObj) AsBool() bool {
@@ -390,15 +566,18 @@ func (t *TclObj) AsBool() bool {
 }
 
 func (t *TclObj) asVarRef() varRef {
-	if t.vrefval == nil {
-		vr := toVarRef(t.AsString())
-		t.vrefval = &vr
+	if vr := t.reps().vrefval.Load(); vr != nil {
+		return *vr
 	}
-	return *t.vrefval
+	vr := toVarRef(t.AsString())
+	t.ownReps().vrefval.Store(&vr)
+	return vr
 }
 
 func FromStr(s string) *TclObj {
-	return &TclObj{value: &s}
+	t := new(TclObj)
+	t.value.Store(&s)
+	return t
 }
 
 var kTrue, kFalse *TclObj
@@ -406,17 +585,25 @@ var smallInts [256]TclObj
 
 func init() {
 	for i := range smallInts {
-		smallInts[i] = TclObj{intval: i, has_intval: true}
+		smallInts[i].intval.Store(int64(i))
+		smallInts[i].has_intval.Store(true)
 	}
 	kTrue = FromInt(1)
 	kFalse = FromInt(0)
 }
 
 func FromInt(i int) *TclObj {
-	if i >= 0 && i < len(smallInts) {
+	return FromInt64(int64(i))
+}
+
+func FromInt64(i int64) *TclObj {
+	if i >= 0 && i < int64(len(smallInts)) {
 		return &smallInts[i]
 	}
-	return &TclObj{intval: i, has_intval: true}
+	t := new(TclObj)
+	t.intval.Store(i)
+	t.has_intval.Store(true)
+	return t
 }
 
 func FromList(l []string) *TclObj {
@@ -436,28 +623,60 @@ func FromBool(b bool) *TclObj {
 	return kFalse
 }
 
-func fromList(items []*TclObj) *TclObj { return &TclObj{listval: items} }
+func fromList(items []*TclObj) *TclObj {
+	t := new(TclObj)
+	t.listval.Store(&items)
+	return t
+}
+
+// appendList returns a list of t's elements followed by items. The
+// list shares t's elements rather than copying them if t has room past
+// its end that no other list has taken, so appending in a loop takes
+// amortized constant time.
+func (t *TclObj) appendList(items []*TclObj) (*TclObj, error) {
+	l, e := t.AsList()
+	if e != nil {
+		return nil, e
+	}
+	var res []*TclObj
+	if cap(l)-len(l) >= len(items) && t.tailFree.CompareAndSwap(true, false) {
+		res = append(l, items...)
+	} else {
+		res = make([]*TclObj, 0, 2*(len(l)+len(items)))
+		res = append(append(res, l...), items...)
+	}
+	n := fromList(res)
+	n.tailFree.Store(true)
+	return n, nil
+}
 
 func (t *TclObj) AsList() ([]*TclObj, error) {
-	if t.listval == nil {
-		var e error
-		t.listval, e = parseList(t.AsString())
-		if e != nil {
-			return nil, e
-		}
+	if l := t.listval.Load(); l != nil {
+		return *l, nil
+	}
+	if d := t.reps().dictval.Load(); d != nil {
+		l := d.list()
+		t.listval.Store(&l)
+		return l, nil
+	}
+	l, e := parseList(t.AsString())
+	if e != nil {
+		return nil, e
 	}
-	return t.listval, nil
+	t.listval.Store(&l)
+	return l, nil
 }
 
 func (t *TclObj) asExpr() (eterm, error) {
-	if t.exprval == nil {
-		ev, err := parseExpr(strings.NewReader(t.AsString()))
-		if err != nil {
-			return nil, err
-		}
-		t.exprval = ev
+	if ev := t.reps().exprval.Load(); ev != nil {
+		return *ev, nil
+	}
+	ev, err := parseExpr(strings.NewReader(t.AsString()))
+	if err != nil {
+		return nil, err
 	}
-	return t.exprval, nil
+	t.ownReps().exprval.Store(&ev)
+	return ev, nil
 }
 
 func parseList(txt string) ([]*TclObj, error) {
@@ -472,12 +691,26 @@ func parseList(txt string) ([]*TclObj, error) {
 	return result, nil
 }
 
+// asBytecode returns t compiled as a script outside of any proc.
+func (t *TclObj) asBytecode() (*bytecode, error) {
+	if bc := t.reps().codeval.Load(); bc != nil {
+		return bc, nil
+	}
+	cmds, e := t.asCmds()
+	if e != nil {
+		return nil, e
+	}
+	bc := compile(cmds, nil)
+	t.ownReps().codeval.Store(bc)
+	return bc, nil
+}
+
 func (i *Interp) EvalObj(obj *TclObj) TclStatus {
-	cmds, e := obj.asCmds()
+	bc, e := obj.asBytecode()
 	if e != nil {
 		return i.Fail(e)
 	}
-	return i.evalCmds(cmds)
+	return i.execute(bc)
 }
 
 type argsig struct {
@@ -485,24 +718,57 @@ type argsig struct {
 	def  *TclObj
 }
 
-func (i *Interp) bindArgs(vnames []argsig, args []*TclObj) error {
+// bindArgs sets the locals of a new proc frame for the parameters in
+// vnames, which are in the slots given by slots. The number of args
+// must already have been checked with arity.
+func bindArgs(f *stackframe, vnames []argsig, slots []int, args []*TclObj) {
 	lastind := len(vnames) - 1
-	var vr varRef
 	for ix, vn := range vnames {
-		vr.name = vn.name
+		v := &f.locals[slots[ix]]
 		if ix == lastind && vn.name == "args" {
-			i.setVar(vr, fromList(args[ix:]))
-			return nil
-		} else if ix >= len(args) {
-			if vn.def == nil {
-				return errors.New("arg count mismatch")
+			if ix <= len(args) {
+				v.obj = fromList(args[ix:])
+			} else {
+				v.obj = kNil
 			}
-			i.setVar(vr, vn.def)
+		} else if ix >= len(args) {
+			v.obj = vn.def
 		} else {
-			i.setVar(vr, args[ix])
+			v.obj = args[ix]
 		}
 	}
-	return nil
+}
+
+// arity returns the fewest arguments a proc with parameters sigs can
+// be called with, and the most, or -1 if it takes args. Defaults only
+// make parameters optional if none after them are required.
+func arity(sigs []argsig) (int, int) {
+	min, max := 0, len(sigs)
+	for ix, s := range sigs {
+		if ix == len(sigs)-1 && s.name == "args" {
+			max = -1
+		} else if s.def == nil {
+			min = ix + 1
+		}
+	}
+	return min, max
+}
+
+// procUsage returns the error for calling name, a proc with parameters
+// sigs, with the wrong number of arguments.
+func procUsage(name string, sigs []argsig) string {
+	words := []string{name}
+	for ix, s := range sigs {
+		switch {
+		case ix == len(sigs)-1 && s.name == "args":
+			words = append(words, "?arg ...?")
+		case s.def != nil:
+			words = append(words, "?"+s.name+"?")
+		default:
+			words = append(words, s.name)
+		}
+	}
+	return "wrong # args: should be \"" + strings.Join(words, " ") + "\""
 }
 
 func makeArgSigs(sig []*TclObj) []argsig {
@@ -518,23 +784,47 @@ func makeArgSigs(sig []*TclObj) []argsig {
 	return sigs
 }
 
-func makeProc(sig []*TclObj, body *TclObj) TclCmd {
+// makeProc returns a command running body with the parameters sig.
+// name is how calls are shown in usage errors.
+func makeProc(name string, sig []*TclObj, body *TclObj) TclCmd {
 	cmds, ce := body.asCmds()
 	if ce != nil {
 		return func(i *Interp, args []*TclObj) TclStatus { return i.Fail(ce) }
 	}
 	sigs := makeArgSigs(sig)
+	min, max := arity(sigs)
+	ltab := &localTable{}
+	slots := make([]int, len(sigs))
+	for ix, s := range sigs {
+		slots[ix] = ltab.slot(s.name)
+	}
+	bc := compile(cmds, ltab)
 	return func(i *Interp, args []*TclObj) TclStatus {
-		i.frame = newstackframe(i.frame)
-		if be := i.bindArgs(sigs, args); be != nil {
-			i.frame = i.frame.next
-			return i.Fail(be)
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			// Name the proc as it was called, which may have been
+			// renamed since it was made.
+			word := i.cmdname
+			if word == "" {
+				word = name
+			}
+			return i.FailStr(procUsage(word, sigs))
+		}
+		f := i.procFrame(ltab)
+		bindArgs(f, sigs, slots, args)
+		i.frame = f
+		d := i.debug
+		if d != nil {
+			d.enter(name, args, f)
+		}
+		rc := i.execute(bc)
+		if d != nil {
+			d.leave()
 		}
-		rc := i.evalCmds(cmds)
 		if rc == kTclReturn {
 			rc = kTclOK
 		}
-		i.frame = i.frame.next
+		i.frame = f.next
+		i.freeFrame(f)
 		return rc
 	}
 }
@@ -547,7 +837,9 @@ func tclProc(i *Interp, args []*TclObj) TclStatus {
 	if err != nil {
 		return i.Fail(err)
 	}
-	i.SetCmd(args[0].AsString(), makeProc(sig, args[2]))
+	name := args[0].AsString()
+	i.SetCmd(name, makeProc(name, sig, args[2]))
+	i.info(name).proc = &procDef{args[1], args[2]}
 	return i.Return(kNil)
 }
 
@@ -563,40 +855,157 @@ func NewInterp() *Interp {
 	i.chans["stderr"] = os.Stderr
 
 	for n, f := range tclBasicCmds {
-		i.SetCmd(n, f)
+		i.cmds[n] = f
+	}
+	for n := range inlineReplaced {
+		i.redefined(n)
 	}
+	i.epoch = nextEpoch()
 
 	i.SetCmd("proc", tclProc)
-	i.SetCmd("error", func(ni *Interp, args []*TclObj) TclStatus { return i.FailStr(args[0].AsString()) })
+	i.SetCmd("error", tclError)
 	return i
 }
 
+func tclError(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args")
+	}
+	return i.FailStr(args[0].AsString())
+}
+
 type TclCmd func(*Interp, []*TclObj) TclStatus
 
 func (i *Interp) SetCmd(name string, cmd TclCmd) {
+	if i.cmdsShared.Load() {
+		cmds := make(map[string]TclCmd, len(i.cmds))
+		for n, c := range i.cmds {
+			cmds[n] = c
+		}
+		i.cmds = cmds
+		i.cmdsShared.Store(false)
+	}
+	if inlineCmds[name] {
+		i.redefined(name)
+	}
 	if cmd == nil {
 		delete(i.cmds, name)
 	} else {
 		i.cmds[name] = cmd
 	}
+	i.epoch = nextEpoch()
+	if ci, ok := i.cmdinfo[name]; ok {
+		delete(i.cmdinfo, name)
+		if ci.deleter != nil {
+			ci.deleter()
+		}
+	}
+}
+
+// cmdInfo is what an interp knows about a command besides its TclCmd.
+// It goes with the command when it's renamed.
+type cmdInfo struct {
+	deleter func()
+	proc    *procDef
+	// For a command defined in Go that a script renamed, the name it
+	// was defined with.
+	origin string
+}
+
+type procDef struct {
+	args, body *TclObj
+}
+
+func (i *Interp) info(name string) *cmdInfo {
+	ci, ok := i.cmdinfo[name]
+	if !ok {
+		if i.cmdinfo == nil {
+			i.cmdinfo = make(map[string]*cmdInfo)
+		}
+		ci = &cmdInfo{}
+		i.cmdinfo[name] = ci
+	}
+	return ci
+}
+
+// SetCmdDeleter arranges for fn to be called when the command name is
+// deleted, either by being replaced or removed, or along with i.
+// Renaming the command doesn't delete it.
+func (i *Interp) SetCmdDeleter(name string, fn func()) {
+	i.info(name).deleter = fn
+}
+
+// redefined records that the builtin name, compiled inline, has been
+// redefined in i. Only its own calls stop running inline. The set is
+// copied rather than changed, since clones share it.
+func (i *Interp) redefined(name string) {
+	if i.replaced[name] {
+		return
+	}
+	replaced := make(map[string]bool, len(i.replaced)+1)
+	for n := range i.replaced {
+		replaced[n] = true
+	}
+	replaced[name] = true
+	i.replaced = replaced
+}
+
+// Command epochs identify versions of command tables, so that call
+// sites can tell whether the command they found last time is still
+// the one they'd find now. They're unique across interps, since
+// parsed scripts are shared between them.
+var cmdEpoch atomic.Uint64
+
+func nextEpoch() uint64 { return cmdEpoch.Add(1) }
+
+// A callSite remembers the command a call in a parsed script last
+// resolved to.
+type callSite struct {
+	cached atomic.Pointer[cachedCmd]
+}
+
+type cachedCmd struct {
+	epoch uint64
+	name  string
+	cmd   TclCmd
+}
+
+// lookupCmd finds the command name called from site.
+func (i *Interp) lookupCmd(site *callSite, name string) (TclCmd, bool) {
+	if c := site.cached.Load(); c != nil && c.epoch == i.epoch && c.name == name {
+		return c.cmd, true
+	}
+	f, ok := i.cmds[name]
+	if ok {
+		site.cached.Store(&cachedCmd{i.epoch, name, f})
+	}
+	return f, ok
 }
 
 func (i *Interp) evalCmds(cmds []command) TclStatus {
 	res := kTclOK
 	for ind := 0; ind < len(cmds) && res == kTclOK; ind++ {
+		if i.debug != nil {
+			if res = i.debug.before(&cmds[ind]); res != kTclOK {
+				break
+			}
+		}
+		if i.cover != nil {
+			i.cover.hit(cmds[ind].pos)
+		}
 		res = cmds[ind].eval(i)
 	}
 	return res
 }
 
-func (i *Interp) getVarMap(global bool) varMap {
+func (i *Interp) varFrame(global bool) *stackframe {
 	f := i.frame
 	if global {
 		for f.next != nil {
 			f = f.next
 		}
 	}
-	return f.vars
+	return f
 }
 
 func (i *Interp) LinkVar(level int, theirs, mine string) {
@@ -605,37 +1014,39 @@ func (i *Interp) LinkVar(level int, theirs, mine string) {
 		theirf = theirf.next
 		level--
 	}
-	m := i.getVarMap(false)
-	m[mine] = &varEntry{link: &framelink{theirf, theirs}}
+	*i.frame.create(mine) = varEntry{link: &framelink{theirf, theirs}}
 }
 
 func (i *Interp) SetVarRaw(name string, val *TclObj) {
 	i.setVar(toVarRef(name), val)
 }
 
+// resolveLinks follows v, the variable name in f, through any upvar
+// links to the variable they refer to, which may not exist.
+func resolveLinks(f *stackframe, name string, v *varEntry) (*stackframe, string, *varEntry) {
+	for v != nil && v.link != nil {
+		f, name = v.link.frame, v.link.name
+		v = f.lookup(name)
+	}
+	return f, name, v
+}
+
 func (i *Interp) setVar(vr varRef, val *TclObj) TclStatus {
-	m := i.getVarMap(vr.is_global)
+	f := i.varFrame(vr.is_global)
 	if val == nil {
-		delete(m, vr.name)
+		f.remove(vr.name)
 		return kTclOK
 	}
-	n := vr.name
-	old, ok := m[n]
-	for ok && old != nil && old.link != nil {
-		m = old.link.frame.vars
-		n = old.link.name
-		old, ok = m[n]
-	}
+	f, n, old := resolveLinks(f, vr.name, f.lookup(vr.name))
 	if old == nil {
-		old = &varEntry{}
-		m[n] = old
+		old = f.create(n)
 		if vr.arrind != nil {
 			old.arrdata = make(map[string]*TclObj)
 		}
-	} else {
-		if vr.arrind != nil && old.arrdata == nil {
-			return i.FailStr("can't set: variable is not an array")
-		}
+	} else if vr.arrind != nil && old.arrdata == nil {
+		return i.FailStr("can't set \"" + vr.name + "\": variable isn't array")
+	} else if vr.arrind == nil && old.arrdata != nil {
+		return i.FailStr("can't set \"" + vr.name + "\": variable is array")
 	}
 	if vr.arrind != nil {
 		rc := vr.arrind.Eval(i)
@@ -655,16 +1066,19 @@ func (i *Interp) GetVarRaw(name string) (*TclObj, error) {
 	return i.getVar(toVarRef(name))
 }
 
-func (i *Interp) getArray(vr varRef) (*varEntry, error) {
-	v, ok := i.getVarMap(vr.is_global)[vr.name]
-	if !ok {
+func (i *Interp) lookupVar(vr varRef) (*varEntry, error) {
+	f := i.varFrame(vr.is_global)
+	_, _, v := resolveLinks(f, vr.name, f.lookup(vr.name))
+	if v == nil {
 		return nil, errors.New("variable not found: " + vr.String())
 	}
-	for v.link != nil {
-		v, ok = v.link.frame.vars[v.link.name]
-		if !ok {
-			return nil, errors.New("variable not found: " + vr.String())
-		}
+	return v, nil
+}
+
+func (i *Interp) getArray(vr varRef) (*varEntry, error) {
+	v, e := i.lookupVar(vr)
+	if e != nil {
+		return nil, e
 	}
 	if v.arrdata == nil {
 		return nil, errors.New("not an array")
@@ -673,16 +1087,15 @@ func (i *Interp) getArray(vr varRef) (*varEntry, error) {
 }
 
 func (i *Interp) getVar(vr varRef) (*TclObj, error) {
-	v, ok := i.getVarMap(vr.is_global)[vr.name]
-	if !ok {
-		return nil, errors.New("variable not found: " + vr.String())
-	}
-	for v.link != nil {
-		v, ok = v.link.frame.vars[v.link.name]
-		if !ok {
-			return nil, errors.New("variable not found: " + vr.String())
-		}
+	v, e := i.lookupVar(vr)
+	if e != nil {
+		return nil, e
 	}
+	return i.varValue(v, vr)
+}
+
+// varValue returns the value of v, which was found with vr.
+func (i *Interp) varValue(v *varEntry, vr varRef) (*TclObj, error) {
 	if vr.arrind != nil {
 		if v.arrdata == nil {
 			return nil, errors.New("can't get: variable isn't array")
@@ -727,13 +1140,33 @@ func evalArgs(i *Interp, toks []tclTok, no_expand bool) ([]*TclObj, TclStatus) {
 
 func (i *Interp) ClearError() { i.err = nil }
 
-func (cmd command) eval(i *Interp) TclStatus {
+// countCmd is called before each command is evaluated.
+func (i *Interp) countCmd() TclStatus {
 	i.cmdcount++
+	if i.limits != nil {
+		return i.checkLimits(true)
+	}
+	return kTclOK
+}
+
+func (cmd *command) eval(i *Interp) TclStatus {
+	if i.countCmd() != kTclOK {
+		return kTclErr
+	}
+	return cmd.evalCounted(i)
+}
+
+// evalCounted is eval for a command that's already been counted.
+func (cmd *command) evalCounted(i *Interp) TclStatus {
 	if len(cmd.words) == 0 {
 		return i.Return(kNil)
 	}
 	if cmd.simple != nil {
-		if f, ok := i.cmds[cmd.simple.cmdname]; ok {
+		if f, ok := i.lookupCmd(cmd.site, cmd.simple.cmdname); ok {
+			i.cmdname = cmd.simple.cmdname
+			if i.prof != nil {
+				return i.prof.call(i, cmd.simple.cmdname, f, cmd.simple.args)
+			}
 			return f(i, cmd.simple.args)
 		}
 	}
@@ -741,8 +1174,30 @@ func (cmd command) eval(i *Interp) TclStatus {
 	if rc != kTclOK {
 		return rc
 	}
+	return i.invokeAt(cmd.site, args)
+}
+
+// invoke calls the command named by args[0] with the rest of args,
+// falling back to unknown if there's no such command.
+func (i *Interp) invoke(args []*TclObj) TclStatus {
+	return i.invokeAt(nil, args)
+}
+
+// invokeAt is invoke for a call from site, which may be nil.
+func (i *Interp) invokeAt(site *callSite, args []*TclObj) TclStatus {
 	fname := args[0].AsString()
-	if f, ok := i.cmds[fname]; ok {
+	var f TclCmd
+	var ok bool
+	if site != nil {
+		f, ok = i.lookupCmd(site, fname)
+	} else {
+		f, ok = i.cmds[fname]
+	}
+	if ok {
+		i.cmdname = fname
+		if i.prof != nil {
+			return i.prof.call(i, fname, f, args[1:])
+		}
 		return f(i, args[1:])
 	}
 	if f, ok := i.cmds["unknown"]; ok {
@@ -751,6 +1206,36 @@ func (cmd command) eval(i *Interp) TclStatus {
 	return i.FailStr("command not found: " + fname)
 }
 
+// Call calls the command name with args, as a script at the current
+// level would, but without building and parsing one.
+func (i *Interp) Call(name string, args ...*TclObj) (*TclObj, error) {
+	cmdline := make([]*TclObj, 0, len(args)+1)
+	return i.result(i.call(append(append(cmdline, FromStr(name)), args...)))
+}
+
+// CallObjs is Call with the command name and arguments in one slice.
+func (i *Interp) CallObjs(cmdline []*TclObj) (*TclObj, error) {
+	if len(cmdline) == 0 {
+		return kNil, nil
+	}
+	return i.result(i.call(append([]*TclObj(nil), cmdline...)))
+}
+
+// CallGlobal is Call at the global level, whatever procs are running.
+func (i *Interp) CallGlobal(name string, args ...*TclObj) (*TclObj, error) {
+	saved := i.frame
+	i.frame = i.varFrame(true)
+	defer func() { i.frame = saved }()
+	return i.Call(name, args...)
+}
+
+func (i *Interp) call(cmdline []*TclObj) TclStatus {
+	if i.countCmd() != kTclOK {
+		return kTclErr
+	}
+	return i.invoke(cmdline)
+}
+
 func (i *Interp) EvalString(s string) (*TclObj, error) {
 	return i.Run(strings.NewReader(s))
 }
@@ -760,7 +1245,12 @@ func (i *Interp) Run(in io.Reader) (*TclObj, error) {
 	if e != nil {
 		return nil, e
 	}
-	r := i.evalCmds(cmds)
+	return i.result(i.evalCmds(cmds))
+}
+
+// result converts the status of a top-level evaluation
+// into a value or an error.
+func (i *Interp) result(r TclStatus) (*TclObj, error) {
 	if r == kTclOK || r == kTclReturn {
 		if i.retval == nil {
 			return kNil, nil
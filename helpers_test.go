@@ -0,0 +1,23 @@
+package gotcl
+
+import "testing"
+
+type scriptTest struct{ script, want string }
+
+// checkScripts evaluates each script in i in turn, comparing its
+// result, or error message, with what's wanted.
+func checkScripts(t *testing.T, i *Interp, tests []scriptTest) {
+	t.Helper()
+	for _, test := range tests {
+		v, e := i.EvalString(test.script)
+		got := ""
+		if e != nil {
+			got = e.Error()
+		} else {
+			got = v.AsString()
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.script, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gotcl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// An index is a position in a list or string as commands take it: an
+// integer, or end, either perhaps plus or minus an integer.
+type index struct {
+	fromEnd bool
+	off     int
+}
+
+func badIndex(s string) error {
+	return errors.New("bad index \"" + s + "\": must be integer?[+-]integer? or end?[+-]integer?")
+}
+
+func parseIndex(s string) (index, error) {
+	t := strings.TrimSpace(s)
+	var x index
+	if strings.HasPrefix(t, "end") {
+		x.fromEnd = true
+		t = t[3:]
+		if t == "" {
+			return x, nil
+		}
+		if t[0] != '+' && t[0] != '-' {
+			return x, badIndex(s)
+		}
+	}
+	// Find where a second integer is added or subtracted, skipping the
+	// sign of the first.
+	split := strings.IndexAny(strings.TrimLeft(t, "+-"), "+-")
+	if split >= 0 {
+		split += len(t) - len(strings.TrimLeft(t, "+-"))
+	}
+	if x.fromEnd || split < 0 {
+		n, e := strconv.Atoi(t)
+		if e != nil {
+			return x, badIndex(s)
+		}
+		x.off = n
+		return x, nil
+	}
+	a, e1 := strconv.Atoi(t[:split])
+	b, e2 := strconv.Atoi(t[split:])
+	if e1 != nil || e2 != nil {
+		return x, badIndex(s)
+	}
+	x.off = a + b
+	return x, nil
+}
+
+// at returns the position x refers to in something n long, where end
+// is its last element.
+func (x index) at(n int) int {
+	if x.fromEnd {
+		return n - 1 + x.off
+	}
+	return x.off
+}
+
+// asIndex returns t parsed as an index, caching it.
+func (t *TclObj) asIndex() (index, error) {
+	if x := t.reps().indexval.Load(); x != nil {
+		return *x, nil
+	}
+	var x index
+	if t.has_intval.Load() {
+		x.off = int(t.intval.Load())
+	} else {
+		var e error
+		if x, e = parseIndex(t.AsString()); e != nil {
+			return x, e
+		}
+	}
+	t.ownReps().indexval.Store(&x)
+	return x, nil
+}
+
+// getIndex returns the position the index t refers to in something n
+// long, failing if t isn't an index. Every command taking an index
+// uses it, so they all agree on what one is.
+func (i *Interp) getIndex(t *TclObj, n int) (int, TclStatus) {
+	x, e := t.asIndex()
+	if e != nil {
+		return 0, i.Fail(e)
+	}
+	return x.at(n), kTclOK
+}
@@ -0,0 +1,611 @@
+package gotcl
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Commands hidden in safe interps, since they can touch the
+// filesystem or the host process. Those that don't exist are skipped.
+var unsafeCmds = []string{
+	"auto_mkindex", "cd", "coverage", "exit", "file", "glob", "go", "load",
+	"open", "profile", "pwd", "source", "zipfs",
+}
+
+var stdChans = []string{"stdin", "stdout", "stderr"}
+
+type alias struct {
+	target  *Interp
+	cmdline []*TclObj // target command followed by any prefix args
+}
+
+func (a *alias) call(i *Interp, args []*TclObj) TclStatus {
+	if a.target.deleted {
+		return i.FailStr("interpreter for alias target has been deleted")
+	}
+	cmdline := make([]*TclObj, 0, len(a.cmdline)+len(args))
+	cmdline = append(append(cmdline, a.cmdline...), args...)
+	return i.transferResult(a.target, a.target.invoke(cmdline))
+}
+
+// transferResult makes the outcome of evaluating something in
+// from with status rc the outcome in i.
+func (i *Interp) transferResult(from *Interp, rc TclStatus) TclStatus {
+	if rc == kTclErr {
+		err := from.err
+		from.ClearError()
+		return i.Fail(err)
+	}
+	i.retval = from.retval
+	return rc
+}
+
+// NewSafeInterp returns an interp in which commands that can touch the
+// filesystem or the host process are hidden, and which has no channels.
+func NewSafeInterp() *Interp {
+	i := NewInterp()
+	i.makeSafe()
+	return i
+}
+
+func (i *Interp) makeSafe() {
+	i.safe = true
+	for _, n := range unsafeCmds {
+		if _, ok := i.cmds[n]; ok {
+			i.HideCmd(n, n)
+		}
+	}
+	for _, n := range stdChans {
+		delete(i.chans, n)
+	}
+}
+
+// IsSafe reports whether i was created as a safe interp.
+func (i *Interp) IsSafe() bool { return i.safe }
+
+// Parent returns the interp that created i, or nil.
+func (i *Interp) Parent() *Interp { return i.parent }
+
+// Child returns the child of i with the given name, or nil.
+func (i *Interp) Child(name string) *Interp { return i.children[name] }
+
+// CreateChild makes a new interp called name, with a command of the same
+// name in i for controlling it. Children of safe interps are always safe.
+func (i *Interp) CreateChild(name string, safe bool) (*Interp, error) {
+	if _, ok := i.children[name]; ok {
+		return nil, errors.New("interpreter named \"" + name + "\" already exists, cannot create")
+	}
+	c := NewInterp()
+	c.parent = i
+	c.vfs = i.vfs
+	if safe || i.safe {
+		c.makeSafe()
+	}
+	if i.children == nil {
+		i.children = make(map[string]*Interp)
+	}
+	i.children[name] = c
+	i.SetCmd(name, func(ci *Interp, args []*TclObj) TclStatus {
+		if len(args) == 0 {
+			return ci.FailStr("wrong # args: should be \"" + name + " cmd ?arg ...?\"")
+		}
+		return interpTargetCmd(ci, c, args[0].AsString(), args[1:])
+	})
+	return c, nil
+}
+
+// DeleteChild deletes the named child of i along with its own children.
+// Aliases into a deleted interp fail when invoked.
+func (i *Interp) DeleteChild(name string) error {
+	c, ok := i.children[name]
+	if !ok {
+		return errors.New("could not find interpreter \"" + name + "\"")
+	}
+	c.delete()
+	delete(i.children, name)
+	i.SetCmd(name, nil)
+	return nil
+}
+
+func (i *Interp) delete() {
+	for _, c := range i.children {
+		c.delete()
+	}
+	i.children = nil
+	for _, ci := range i.cmdinfo {
+		if ci.deleter != nil {
+			ci.deleter()
+		}
+	}
+	i.cmdinfo = nil
+	i.deleted = true
+}
+
+// Alias makes name in i invoke targetCmd in target, with prefix
+// inserted before the arguments. A nil target removes the alias.
+func (i *Interp) Alias(name string, target *Interp, targetCmd string, prefix ...*TclObj) {
+	if target == nil {
+		if _, ok := i.aliases[name]; ok {
+			delete(i.aliases, name)
+			i.SetCmd(name, nil)
+		}
+		return
+	}
+	a := &alias{target: target, cmdline: append([]*TclObj{FromStr(targetCmd)}, prefix...)}
+	if i.aliases == nil {
+		i.aliases = make(map[string]*alias)
+	}
+	i.aliases[name] = a
+	i.SetCmd(name, a.call)
+}
+
+// HideCmd makes the command name invisible to scripts in i. It can
+// still be called with InvokeHidden under hiddenName.
+func (i *Interp) HideCmd(name, hiddenName string) error {
+	c, ok := i.cmds[name]
+	if !ok {
+		return errors.New("unknown command \"" + name + "\"")
+	}
+	if _, ok := i.hidden[hiddenName]; ok {
+		return errors.New("hidden command named \"" + hiddenName + "\" already exists")
+	}
+	if i.hidden == nil {
+		i.hidden = make(map[string]TclCmd)
+	}
+	i.hidden[hiddenName] = c
+	i.SetCmd(name, nil)
+	return nil
+}
+
+// ExposeCmd undoes HideCmd, making hiddenName visible as name.
+func (i *Interp) ExposeCmd(hiddenName, name string) error {
+	c, ok := i.hidden[hiddenName]
+	if !ok {
+		return errors.New("unknown hidden command \"" + hiddenName + "\"")
+	}
+	if _, ok := i.cmds[name]; ok {
+		return errors.New("exposed command \"" + name + "\" already exists")
+	}
+	delete(i.hidden, hiddenName)
+	i.SetCmd(name, c)
+	return nil
+}
+
+// InvokeHidden calls the hidden command name at the current level of i.
+func (i *Interp) InvokeHidden(name string, args ...*TclObj) (*TclObj, error) {
+	c, ok := i.hidden[name]
+	if !ok {
+		return nil, errors.New("invalid hidden command name \"" + name + "\"")
+	}
+	return i.result(c(i, args))
+}
+
+func (i *Interp) moveChan(name string, dest *Interp, keep bool) error {
+	ch, ok := i.chans[name]
+	if !ok {
+		return errors.New("can not find channel named \"" + name + "\"")
+	}
+	if _, ok := dest.chans[name]; ok {
+		return errors.New("channel \"" + name + "\" already exists in target")
+	}
+	dest.chans[name] = ch
+	if !keep {
+		delete(i.chans, name)
+	}
+	return nil
+}
+
+// ShareChan makes the channel name in i available in dest as well.
+func (i *Interp) ShareChan(name string, dest *Interp) error {
+	return i.moveChan(name, dest, true)
+}
+
+// TransferChan moves the channel name from i to dest.
+func (i *Interp) TransferChan(name string, dest *Interp) error {
+	return i.moveChan(name, dest, false)
+}
+
+// resolvePath finds the interp named by path, a list of names
+// of successive children starting at i. The empty list is i itself.
+func (i *Interp) resolvePath(path *TclObj) (*Interp, error) {
+	names, e := path.AsList()
+	if e != nil {
+		return nil, e
+	}
+	cur := i
+	for _, n := range names {
+		if cur = cur.children[n.AsString()]; cur == nil {
+			return nil, errors.New("could not find interpreter \"" + path.AsString() + "\"")
+		}
+	}
+	return cur, nil
+}
+
+// resolveParent splits path into the interp that holds its
+// last element and that element's name.
+func (i *Interp) resolveParent(path *TclObj) (*Interp, string, error) {
+	names, e := path.AsList()
+	if e != nil {
+		return nil, "", e
+	}
+	if len(names) == 0 {
+		return nil, "", errors.New("cannot use the current interpreter here")
+	}
+	p, e := i.resolvePath(fromList(names[:len(names)-1]))
+	if e != nil {
+		return nil, "", e
+	}
+	return p, names[len(names)-1].AsString(), nil
+}
+
+func (i *Interp) newChildName() string {
+	for n := 0; ; n++ {
+		name := "interp" + strconv.Itoa(n)
+		if _, ok := i.children[name]; !ok {
+			return name
+		}
+	}
+}
+
+func interpCreate(i *Interp, args []*TclObj) TclStatus {
+	safe := false
+	for len(args) > 0 {
+		opt := args[0].AsString()
+		if opt == "-safe" {
+			safe = true
+		} else if opt == "--" {
+			args = args[1:]
+			break
+		} else {
+			break
+		}
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return i.FailStr("wrong # args: should be \"interp create ?-safe? ?--? ?path?\"")
+	}
+	path := FromStr(i.newChildName())
+	if len(args) == 1 {
+		path = args[0]
+	}
+	p, name, e := i.resolveParent(path)
+	if e != nil {
+		return i.Fail(e)
+	}
+	if _, e := p.CreateChild(name, safe); e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(path)
+}
+
+func interpDelete(i *Interp, args []*TclObj) TclStatus {
+	for _, path := range args {
+		p, name, e := i.resolveParent(path)
+		if e != nil {
+			return i.Fail(e)
+		}
+		if e := p.DeleteChild(name); e != nil {
+			return i.Fail(e)
+		}
+	}
+	return i.Return(kNil)
+}
+
+func interpExists(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"interp exists path\"")
+	}
+	_, e := i.resolvePath(args[0])
+	return i.Return(FromBool(e == nil))
+}
+
+func interpChildren(i *Interp, args []*TclObj) TclStatus {
+	if len(args) > 1 {
+		return i.FailStr("wrong # args: should be \"interp children ?path?\"")
+	}
+	p := i
+	if len(args) == 1 {
+		var e error
+		if p, e = i.resolvePath(args[0]); e != nil {
+			return i.Fail(e)
+		}
+	}
+	names := make([]string, 0, len(p.children))
+	for n := range p.children {
+		names = append(names, n)
+	}
+	return i.Return(FromList(names))
+}
+
+func interpMoveChan(keep bool) TclCmd {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		if len(args) != 3 {
+			return i.FailStr("wrong # args: should be \"interp share srcPath channelId destPath\"")
+		}
+		src, e := i.resolvePath(args[0])
+		if e != nil {
+			return i.Fail(e)
+		}
+		dest, e := i.resolvePath(args[2])
+		if e != nil {
+			return i.Fail(e)
+		}
+		if e := src.moveChan(args[1].AsString(), dest, keep); e != nil {
+			return i.Fail(e)
+		}
+		return i.Return(kNil)
+	}
+}
+
+// interp alias srcPath srcToken ?targetPath targetCmd ?arg ...??
+func interpAlias(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"interp alias srcPath srcToken ?targetPath targetCmd ?arg ...??\"")
+	}
+	src, e := i.resolvePath(args[0])
+	if e != nil {
+		return i.Fail(e)
+	}
+	if len(args) < 4 {
+		return aliasCmd(i, src, nil, args[1:])
+	}
+	target, e := i.resolvePath(args[2])
+	if e != nil {
+		return i.Fail(e)
+	}
+	return aliasCmd(i, src, target, append([]*TclObj{args[1]}, args[3:]...))
+}
+
+// aliasCmd queries, deletes or creates the alias args[0] in src,
+// depending on whether args has one, two or more elements.
+func aliasCmd(i *Interp, src, target *Interp, args []*TclObj) TclStatus {
+	name := args[0].AsString()
+	switch {
+	case len(args) == 1:
+		a, ok := src.aliases[name]
+		if !ok {
+			return i.FailStr("alias \"" + name + "\" not found")
+		}
+		return i.Return(fromList(a.cmdline))
+	case len(args) == 2 && args[1].AsString() == "":
+		if _, ok := src.aliases[name]; !ok {
+			return i.FailStr("alias \"" + name + "\" not found")
+		}
+		src.Alias(name, nil, "")
+		return i.Return(kNil)
+	case target == nil:
+		return i.FailStr("wrong # args: should be \"interp alias srcPath srcToken ?targetPath targetCmd ?arg ...??\"")
+	}
+	src.Alias(name, target, args[1].AsString(), args[2:]...)
+	return i.Return(args[0])
+}
+
+func interpLimit(i *Interp, c *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"interp limit path limitType ?-option value ...?\"")
+	}
+	kind := args[0].AsString()
+	opts := args[1:]
+	if len(opts)&1 != 0 {
+		return i.FailStr("wrong # args: option \"" + opts[len(opts)-1].AsString() + "\" needs a value")
+	}
+	// An interp mustn't be able to lift the limits it runs under.
+	if len(opts) > 0 && c == i {
+		return i.FailStr("permission denied: an interpreter cannot change its own limits")
+	}
+	if len(opts) > 0 && i.safe {
+		return i.FailStr("permission denied: safe interpreter cannot change limits")
+	}
+	switch kind {
+	case "commands":
+		if len(opts) == 0 {
+			val := kNil
+			if c.limits != nil && c.limits.cmdsLeft != nil {
+				val = FromInt(c.cmdcount + int(*c.limits.cmdsLeft))
+			}
+			return i.Return(fromList([]*TclObj{FromStr("-value"), val}))
+		}
+		for ; len(opts) > 0; opts = opts[2:] {
+			if opts[0].AsString() != "-value" {
+				return i.FailStr("bad option \"" + opts[0].AsString() + "\": must be -value")
+			}
+			if opts[1].AsString() == "" {
+				c.SetCommandLimit(0)
+				continue
+			}
+			n, e := opts[1].AsInt()
+			if e != nil {
+				return i.Fail(e)
+			}
+			left := int64(n - c.cmdcount)
+			c.getLimits().cmdsLeft = &left
+		}
+	case "time":
+		var deadline time.Time
+		if c.limits != nil {
+			deadline = c.limits.deadline
+		}
+		if len(opts) == 0 {
+			secs, ms := kNil, kNil
+			if !deadline.IsZero() {
+				secs = FromInt(int(deadline.Unix()))
+				ms = FromInt(deadline.Nanosecond() / int(time.Millisecond))
+			}
+			return i.Return(fromList([]*TclObj{
+				FromStr("-milliseconds"), ms, FromStr("-seconds"), secs}))
+		}
+		secs, ms := deadline.Unix(), deadline.Nanosecond()/int(time.Millisecond)
+		for ; len(opts) > 0; opts = opts[2:] {
+			if opts[1].AsString() == "" {
+				c.SetTimeLimit(time.Time{})
+				return i.Return(kNil)
+			}
+			n, e := opts[1].AsInt()
+			if e != nil {
+				return i.Fail(e)
+			}
+			switch opts[0].AsString() {
+			case "-seconds":
+				secs = int64(n)
+			case "-milliseconds":
+				ms = n
+			default:
+				return i.FailStr("bad option \"" + opts[0].AsString() + "\": must be -milliseconds or -seconds")
+			}
+		}
+		c.SetTimeLimit(time.Unix(secs, int64(ms)*int64(time.Millisecond)))
+	default:
+		return i.FailStr("bad limit type \"" + kind + "\": must be commands or time")
+	}
+	return i.Return(kNil)
+}
+
+// interpTargetCmd runs the subcommands that operate on a particular interp,
+// which are shared between "interp cmd path ..." and "path cmd ...", the
+// command made for each child. The alias subcommand is only reached through
+// the latter.
+func interpTargetCmd(i *Interp, c *Interp, cmd string, args []*TclObj) TclStatus {
+	switch cmd {
+	case "alias":
+		if len(args) == 0 {
+			return i.FailStr("wrong # args: should be \"path alias aliasName ?targetName? ?arg ...?\"")
+		}
+		return aliasCmd(i, c, i, args)
+	case "aliases":
+		names := make([]string, 0, len(c.aliases))
+		for n := range c.aliases {
+			names = append(names, n)
+		}
+		return i.Return(FromList(names))
+	case "eval":
+		if len(args) == 0 {
+			return i.FailStr("wrong # args: should be \"interp eval path arg ?arg ...?\"")
+		}
+		script := args[0]
+		if len(args) > 1 {
+			script = concat(args)
+		}
+		v, e := c.result(c.EvalObj(script))
+		c.ClearError()
+		if e != nil {
+			return i.Fail(e)
+		}
+		return i.Return(v)
+	case "expose", "hide":
+		if len(args) != 1 && len(args) != 2 {
+			return i.FailStr("wrong # args: should be \"interp " + cmd + " path name ?newName?\"")
+		}
+		if i.safe {
+			return i.FailStr("permission denied: safe interpreter cannot " + cmd + " commands")
+		}
+		from, to := args[0].AsString(), args[len(args)-1].AsString()
+		var e error
+		if cmd == "hide" {
+			e = c.HideCmd(from, to)
+		} else {
+			e = c.ExposeCmd(from, to)
+		}
+		if e != nil {
+			return i.Fail(e)
+		}
+		return i.Return(kNil)
+	case "hidden":
+		names := make([]string, 0, len(c.hidden))
+		for n := range c.hidden {
+			names = append(names, n)
+		}
+		return i.Return(FromList(names))
+	case "invokehidden":
+		if i.safe {
+			return i.FailStr("permission denied: safe interpreter cannot invoke hidden commands")
+		}
+		global := false
+		if len(args) > 0 && args[0].AsString() == "-global" {
+			global = true
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return i.FailStr("wrong # args: should be \"interp invokehidden path ?-global? cmd ?arg ...?\"")
+		}
+		orig_frame := c.frame
+		if global {
+			for c.frame.next != nil {
+				c.frame = c.frame.next
+			}
+		}
+		v, e := c.InvokeHidden(args[0].AsString(), args[1:]...)
+		c.frame = orig_frame
+		c.ClearError()
+		if e != nil {
+			return i.Fail(e)
+		}
+		return i.Return(v)
+	case "issafe":
+		return i.Return(FromBool(c.safe))
+	case "limit":
+		return interpLimit(i, c, args)
+	}
+	return i.FailStr("unknown or ambiguous subcommand \"" + cmd + "\". Must be " +
+		formatNames(append([]string{"alias"}, interpTargetNames...)) + ".")
+}
+
+var interpTargetNames = []string{
+	"aliases", "eval", "expose", "hide", "hidden", "invokehidden", "issafe", "limit",
+}
+
+var interpCmds = map[string]TclCmd{
+	"create":   interpCreate,
+	"delete":   interpDelete,
+	"exists":   interpExists,
+	"children": interpChildren,
+	"slaves":   interpChildren,
+	"share":    interpMoveChan(true),
+	"transfer": interpMoveChan(false),
+}
+
+// Subcommands whose path argument may be left off to mean the current interp.
+var interpOptionalPath = map[string]bool{
+	"aliases": true, "hidden": true, "issafe": true,
+}
+
+func tclInterp(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"interp cmd ?arg ...?\"")
+	}
+	cmd := args[0].AsString()
+	if c, ok := interpCmds[cmd]; ok {
+		return c(i, args[1:])
+	}
+	if cmd == "alias" {
+		return interpAlias(i, args[1:])
+	}
+	known := false
+	for _, n := range interpTargetNames {
+		known = known || n == cmd
+	}
+	if !known {
+		names := append([]string{"alias"}, interpTargetNames...)
+		for n := range interpCmds {
+			names = append(names, n)
+		}
+		return i.FailStr("unknown or ambiguous subcommand \"" + cmd + "\". Must be " + formatNames(names) + ".")
+	}
+	target := i
+	if len(args) > 1 {
+		var e error
+		if target, e = i.resolvePath(args[1]); e != nil {
+			return i.Fail(e)
+		}
+		args = args[2:]
+	} else if interpOptionalPath[cmd] {
+		args = nil
+	} else {
+		return i.FailStr("wrong # args: should be \"interp " + cmd + " path ?arg ...?\"")
+	}
+	return interpTargetCmd(i, target, cmd, args)
+}
+
+func init() {
+	RegisterDefaultCmd("interp", tclInterp)
+}
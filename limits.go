@@ -0,0 +1,133 @@
+package gotcl
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Errors reported when evaluation is aborted by a resource limit.
+// Like context cancellation, these can't be caught by scripts; they
+// unwind all the way back to the Go caller.
+var (
+	ErrCommandLimit = errors.New("command count limit exceeded")
+	ErrTimeLimit    = errors.New("time limit exceeded")
+)
+
+// Number of limit checks between looks at the clock and the context,
+// since both are much more expensive than counting commands.
+const limitGranularity = 64
+
+type limits struct {
+	ctx      context.Context
+	deadline time.Time
+	// Commands left to run. Shared with the interps of goroutines
+	// started with go, so they can't be used to escape the limit.
+	cmdsLeft *int64
+	ticks    int
+	err      error
+}
+
+func (l *limits) expired() error {
+	if l.ctx != nil {
+		if err := l.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		return ErrTimeLimit
+	}
+	return nil
+}
+
+// inherit returns the limits for an interp running on behalf of
+// the one limited by l.
+func (l *limits) inherit() *limits {
+	if l == nil {
+		return nil
+	}
+	return &limits{ctx: l.ctx, deadline: l.deadline, cmdsLeft: l.cmdsLeft}
+}
+
+// checkLimits is called for each command evaluated (count is true) and
+// for each loop iteration while any limit is in effect. Once a limit
+// has been hit, every later check fails too.
+func (i *Interp) checkLimits(count bool) TclStatus {
+	l := i.limits
+	if l.err == nil {
+		if count && l.cmdsLeft != nil && atomic.AddInt64(l.cmdsLeft, -1) < 0 {
+			l.err = ErrCommandLimit
+		} else if l.ticks++; l.ticks >= limitGranularity {
+			l.ticks = 0
+			l.err = l.expired()
+		}
+	}
+	if l.err != nil {
+		return i.Fail(l.err)
+	}
+	return kTclOK
+}
+
+// limitExceeded reports whether evaluation is being aborted by a limit,
+// in which case errors must not be caught.
+func (i *Interp) limitExceeded() bool {
+	return i.limits != nil && i.limits.err != nil
+}
+
+// done returns a channel that's closed when the evaluation context is
+// cancelled, for commands that block.
+func (i *Interp) done() <-chan struct{} {
+	if i.limits == nil || i.limits.ctx == nil {
+		return nil
+	}
+	return i.limits.ctx.Done()
+}
+
+// cancelled fails with the context's error once done's channel is closed.
+func (i *Interp) cancelled() TclStatus {
+	i.limits.err = i.limits.ctx.Err()
+	return i.Fail(i.limits.err)
+}
+
+func (i *Interp) getLimits() *limits {
+	if i.limits == nil {
+		i.limits = new(limits)
+	}
+	i.limits.err = nil
+	return i.limits
+}
+
+// SetCommandLimit allows i to evaluate at most n more commands, counting
+// those run by goroutines it starts. A limit of 0 or less removes it.
+func (i *Interp) SetCommandLimit(n int) {
+	l := i.getLimits()
+	if n <= 0 {
+		l.cmdsLeft = nil
+		return
+	}
+	left := int64(n)
+	l.cmdsLeft = &left
+}
+
+// SetTimeLimit aborts any evaluation in i still running at deadline.
+// The zero time removes the limit.
+func (i *Interp) SetTimeLimit(deadline time.Time) {
+	i.getLimits().deadline = deadline
+}
+
+// EvalContext evaluates s, aborting with ctx.Err() if ctx is cancelled
+// or its deadline passes first.
+func (i *Interp) EvalContext(ctx context.Context, s string) (*TclObj, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	saved := i.limits
+	l := &limits{ctx: ctx}
+	if saved != nil {
+		l.deadline, l.cmdsLeft, l.err = saved.deadline, saved.cmdsLeft, saved.err
+	}
+	i.limits = l
+	defer func() { i.limits = saved }()
+	return i.EvalString(s)
+}
@@ -0,0 +1,54 @@
+package gotcl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvalContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, e := NewInterp().EvalContext(ctx, "while 1 {}")
+	if !errors.Is(e, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", e)
+	}
+}
+
+func TestEvalContextBlockedRecv(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, e := NewInterp().EvalContext(ctx, "<- [newchan]")
+	if !errors.Is(e, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", e)
+	}
+}
+
+func TestCommandLimitUncatchable(t *testing.T) {
+	i := NewInterp()
+	i.SetCommandLimit(1000)
+	_, e := i.EvalString("catch { while 1 { set x 1 } }\nset caught 1")
+	if !errors.Is(e, ErrCommandLimit) {
+		t.Fatalf("expected command limit error, got %v", e)
+	}
+	if _, e := i.GetVarRaw("caught"); e == nil {
+		t.Fatal("catch swallowed the limit error")
+	}
+	if _, e := i.EvalString("set x 2"); !errors.Is(e, ErrCommandLimit) {
+		t.Fatalf("limit should still apply, got %v", e)
+	}
+	i.SetCommandLimit(0)
+	if _, e := i.EvalString("set x 2"); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	i := NewInterp()
+	i.SetTimeLimit(time.Now().Add(20 * time.Millisecond))
+	_, e := i.EvalString("for {set i 0} {1} {incr i} {}")
+	if !errors.Is(e, ErrTimeLimit) {
+		t.Fatalf("expected time limit error, got %v", e)
+	}
+}
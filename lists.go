@@ -0,0 +1,350 @@
+package gotcl
+
+import (
+	"strings"
+)
+
+// The lists AsList returns are shared by every user of the object, so
+// these commands copy what they change rather than altering them.
+
+func tclLrange(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 3 {
+		return i.FailStr("wrong # args: should be \"lrange list first last\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	first, rc := i.getIndex(args[1], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	last, rc := i.getIndex(args[2], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	first, last = max(first, 0), min(last, len(l)-1)
+	if first > last {
+		return i.Return(kNil)
+	}
+	return i.Return(fromList(append([]*TclObj(nil), l[first:last+1]...)))
+}
+
+// replaceRange returns l with the elements from first to last replaced
+// by items, inserting them before first if last is before it.
+func replaceRange(l []*TclObj, first, last int, items []*TclObj) []*TclObj {
+	first = min(max(first, 0), len(l))
+	last = min(max(last+1, first), len(l))
+	res := make([]*TclObj, 0, len(l)-(last-first)+len(items))
+	res = append(append(append(res, l[:first]...), items...), l[last:]...)
+	return res
+}
+
+func tclLreplace(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 3 {
+		return i.FailStr("wrong # args: should be \"lreplace list first last ?element ...?\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	first, rc := i.getIndex(args[1], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	last, rc := i.getIndex(args[2], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(fromList(replaceRange(l, first, last, args[3:])))
+}
+
+func tclLinsert(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"linsert list index ?element ...?\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	// end is after the last element here, so end appends.
+	at, rc := i.getIndex(args[1], len(l)+1)
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(fromList(replaceRange(l, at, at-1, args[2:])))
+}
+
+func tclLreverse(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"lreverse list\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	res := make([]*TclObj, len(l))
+	for ix, v := range l {
+		res[len(l)-1-ix] = v
+	}
+	return i.Return(fromList(res))
+}
+
+func tclLrepeat(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"lrepeat count ?value ...?\"")
+	}
+	n, e := args[0].AsInt()
+	if e != nil {
+		return i.Fail(e)
+	}
+	if n < 0 {
+		return i.FailStr("bad count \"" + args[0].AsString() + "\": must be integer >= 0")
+	}
+	vals := args[1:]
+	if len(vals) == 0 {
+		return i.Return(kNil)
+	}
+	if n > maxListLen/len(vals) {
+		return i.FailStr("max length of a Tcl list exceeded")
+	}
+	res := make([]*TclObj, 0, n*len(vals))
+	for ; n > 0; n-- {
+		res = append(res, vals...)
+	}
+	return i.Return(fromList(res))
+}
+
+// maxListLen is the most elements a command will make a list of in one
+// go, so a mistaken count fails rather than exhausting memory.
+const maxListLen = 1 << 28
+
+// indexPath returns the indices a command was given: the words in args,
+// or the elements of its only word.
+func indexPath(args []*TclObj) ([]*TclObj, error) {
+	if len(args) == 1 {
+		return args[0].AsList()
+	}
+	return args, nil
+}
+
+// setIn returns l with the element at path set to v, path being indices
+// into l and the lists nested in it. An index can be one past the end,
+// appending v.
+func (i *Interp) setIn(l []*TclObj, path []*TclObj, v *TclObj) ([]*TclObj, TclStatus) {
+	at, rc := i.getIndex(path[0], len(l))
+	if rc != kTclOK {
+		return nil, rc
+	}
+	if at < 0 || at > len(l) {
+		return nil, i.FailStr("list index out of range")
+	}
+	if len(path) > 1 {
+		var inner []*TclObj
+		if at < len(l) {
+			var e error
+			if inner, e = l[at].AsList(); e != nil {
+				return nil, i.Fail(e)
+			}
+		}
+		inner, rc = i.setIn(inner, path[1:], v)
+		if rc != kTclOK {
+			return nil, rc
+		}
+		v = fromList(inner)
+	}
+	res := append(make([]*TclObj, 0, len(l)+1), l...)
+	if at == len(l) {
+		return append(res, v), kTclOK
+	}
+	res[at] = v
+	return res, kTclOK
+}
+
+// listVar returns the list in the variable named by t.
+func (i *Interp) listVar(t *TclObj) ([]*TclObj, TclStatus) {
+	v, e := i.getVar(t.asVarRef())
+	if e != nil {
+		return nil, i.Fail(e)
+	}
+	l, e := v.AsList()
+	if e != nil {
+		return nil, i.Fail(e)
+	}
+	return l, kTclOK
+}
+
+func tclLset(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"lset listVar ?index? ?index ...? value\"")
+	}
+	v := args[len(args)-1]
+	path, e := indexPath(args[1 : len(args)-1])
+	if e != nil {
+		return i.Fail(e)
+	}
+	if len(path) == 0 {
+		return i.setVar(args[0].asVarRef(), v)
+	}
+	l, rc := i.listVar(args[0])
+	if rc != kTclOK {
+		return rc
+	}
+	if l, rc = i.setIn(l, path, v); rc != kTclOK {
+		return rc
+	}
+	return i.setVar(args[0].asVarRef(), fromList(l))
+}
+
+func tclLassign(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"lassign list ?varName ...?\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	for ix, name := range args[1:] {
+		v := kNil
+		if ix < len(l) {
+			v = l[ix]
+		}
+		if rc := i.setVar(name.asVarRef(), v); rc != kTclOK {
+			return rc
+		}
+	}
+	if len(args)-1 >= len(l) {
+		return i.Return(kNil)
+	}
+	return i.Return(fromList(append([]*TclObj(nil), l[len(args)-1:]...)))
+}
+
+func tclJoin(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 && len(args) != 2 {
+		return i.FailStr("wrong # args: should be \"join list ?joinString?\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	sep := " "
+	if len(args) == 2 {
+		sep = args[1].AsString()
+	}
+	var sb strings.Builder
+	for ix, v := range l {
+		if ix != 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(v.AsString())
+	}
+	return i.Return(FromStr(sb.String()))
+}
+
+// popIn returns l without the element at path, and that element.
+func (i *Interp) popIn(l []*TclObj, path []*TclObj) ([]*TclObj, *TclObj, TclStatus) {
+	at, rc := i.getIndex(path[0], len(l))
+	if rc != kTclOK {
+		return nil, nil, rc
+	}
+	if at < 0 || at >= len(l) {
+		return nil, nil, i.FailStr("index \"" + path[0].AsString() + "\" out of range")
+	}
+	if len(path) == 1 {
+		return replaceRange(l, at, at, nil), l[at], kTclOK
+	}
+	inner, e := l[at].AsList()
+	if e != nil {
+		return nil, nil, i.Fail(e)
+	}
+	inner, v, rc := i.popIn(inner, path[1:])
+	if rc != kTclOK {
+		return nil, nil, rc
+	}
+	res := append([]*TclObj(nil), l...)
+	res[at] = fromList(inner)
+	return res, v, kTclOK
+}
+
+func tclLpop(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"lpop listvar ?index?\"")
+	}
+	path, e := indexPath(args[1:])
+	if e != nil {
+		return i.Fail(e)
+	}
+	if len(path) == 0 {
+		path = []*TclObj{FromStr("end")}
+	}
+	l, rc := i.listVar(args[0])
+	if rc != kTclOK {
+		return rc
+	}
+	l, v, rc := i.popIn(l, path)
+	if rc != kTclOK {
+		return rc
+	}
+	if rc := i.setVar(args[0].asVarRef(), fromList(l)); rc != kTclOK {
+		return rc
+	}
+	return i.Return(v)
+}
+
+func tclLremove(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 1 {
+		return i.FailStr("wrong # args: should be \"lremove list ?index ...?\"")
+	}
+	l, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	gone := make(map[int]bool)
+	for _, a := range args[1:] {
+		at, rc := i.getIndex(a, len(l))
+		if rc != kTclOK {
+			return rc
+		}
+		gone[at] = true
+	}
+	res := make([]*TclObj, 0, len(l))
+	for ix, v := range l {
+		if !gone[ix] {
+			res = append(res, v)
+		}
+	}
+	return i.Return(fromList(res))
+}
+
+func tclLedit(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 3 {
+		return i.FailStr("wrong # args: should be \"ledit listVar first last ?element ...?\"")
+	}
+	l, rc := i.listVar(args[0])
+	if rc != kTclOK {
+		return rc
+	}
+	first, rc := i.getIndex(args[1], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	last, rc := i.getIndex(args[2], len(l))
+	if rc != kTclOK {
+		return rc
+	}
+	return i.setVar(args[0].asVarRef(), fromList(replaceRange(l, first, last, args[3:])))
+}
+
+func init() {
+	RegisterDefaultCmd("lrange", tclLrange)
+	RegisterDefaultCmd("lreplace", tclLreplace)
+	RegisterDefaultCmd("linsert", tclLinsert)
+	RegisterDefaultCmd("lreverse", tclLreverse)
+	RegisterDefaultCmd("lrepeat", tclLrepeat)
+	RegisterDefaultCmd("lset", tclLset)
+	RegisterDefaultCmd("lassign", tclLassign)
+	RegisterDefaultCmd("join", tclJoin)
+	RegisterDefaultCmd("lpop", tclLpop)
+	RegisterDefaultCmd("lremove", tclLremove)
+	RegisterDefaultCmd("ledit", tclLedit)
+}
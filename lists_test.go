@@ -0,0 +1,57 @@
+package gotcl
+
+import "testing"
+
+func TestParseIndex(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want int
+	}{
+		{"0", 5, 0},
+		{"end", 5, 4},
+		{"end-1", 5, 3},
+		{"end+1", 5, 5},
+		{"1+2", 5, 3},
+		{"5-6", 5, -1},
+		{"-1+3", 5, 2},
+		{"-2", 5, -2},
+	}
+	for _, test := range tests {
+		x, e := parseIndex(test.s)
+		if e != nil || x.at(test.n) != test.want {
+			t.Errorf("%q: got %d, %v, want %d", test.s, x.at(test.n), e, test.want)
+		}
+	}
+	for _, s := range []string{"", "en", "end1", "end-", "1+", "x", "end-1-1"} {
+		if _, e := parseIndex(s); e == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"lrange {a b} x 1", `bad index "x": must be integer?[+-]integer? or end?[+-]integer?`},
+		{"lrange {a b}", `wrong # args: should be "lrange list first last"`},
+		{"lrepeat -1 a", `bad count "-1": must be integer >= 0`},
+		{"lrepeat 4611686018427387904 a b", "max length of a Tcl list exceeded"},
+		{"lrepeat 300000000 a", "max length of a Tcl list exceeded"},
+		{"set x {a b}\nlset x 3 c", "list index out of range"},
+		{"lpop x 2", `index "2" out of range`},
+		{"lpop nosuch", "variable not found: $nosuch"},
+	})
+}
+
+func TestIndexCommands(t *testing.T) {
+	// Every command taking an index reads it the same way.
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"lindex {a b c} x", `bad index "x": must be integer?[+-]integer? or end?[+-]integer?`},
+		{"string index abc x", `bad index "x": must be integer?[+-]integer? or end?[+-]integer?`},
+		{"lindex", `wrong # args: should be "lindex list ?index ...?"`},
+	})
+	x := FromStr("end-1")
+	if _, e := x.asIndex(); e != nil || x.reps().indexval.Load() == nil {
+		t.Errorf("index not cached: %v", e)
+	}
+}
@@ -0,0 +1,235 @@
+package gotcl
+
+import (
+	"regexp"
+	"strings"
+)
+
+type searchMode int
+
+const (
+	searchGlob searchMode = iota
+	searchExact
+	searchRegexp
+)
+
+const lsearchOptions = "-all, -ascii, -decreasing, -dictionary, -exact, -glob, -increasing, -index, -inline, -integer, -nocase, -not, -real, -regexp, -sorted, or -start"
+
+func tclLsearch(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"lsearch ?-option value ...? list pattern\"")
+	}
+	var c listCompare
+	mode, modeGiven := searchGlob, false
+	all, inline, not, sorted, decreasing := false, false, false, false, false
+	var start *TclObj
+	opts := args[:len(args)-2]
+	for len(opts) > 0 {
+		opt := opts[0].AsString()
+		opts = opts[1:]
+		switch opt {
+		case "-all":
+			all = true
+		case "-inline":
+			inline = true
+		case "-not":
+			not = true
+		case "-exact":
+			mode, modeGiven = searchExact, true
+		case "-glob":
+			mode, modeGiven = searchGlob, true
+		case "-regexp":
+			mode, modeGiven = searchRegexp, true
+		case "-sorted":
+			sorted = true
+		case "-nocase":
+			c.nocase = true
+		case "-ascii":
+			c.kind = cmpAscii
+		case "-dictionary":
+			c.kind = cmpDictionary
+		case "-integer":
+			c.kind = cmpInteger
+		case "-real":
+			c.kind = cmpReal
+		case "-increasing":
+			decreasing = false
+		case "-decreasing":
+			decreasing = true
+		case "-start":
+			if len(opts) == 0 {
+				return i.FailStr("missing starting index")
+			}
+			start, opts = opts[0], opts[1:]
+		case "-index":
+			if len(opts) == 0 {
+				return i.FailStr("\"-index\" option must be followed by list index")
+			}
+			var e error
+			if c.index, e = opts[0].AsList(); e != nil {
+				return i.Fail(e)
+			}
+			opts = opts[1:]
+		default:
+			return i.FailStr("bad option \"" + opt + "\": must be " + lsearchOptions)
+		}
+	}
+	l, e := args[len(args)-2].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	pat := args[len(args)-1]
+	from := 0
+	if start != nil {
+		at, rc := i.getIndex(start, len(l))
+		if rc != kTclOK {
+			return rc
+		}
+		from = max(at, 0)
+	}
+	// Sorted searches are exact unless told otherwise, and only exact
+	// ones compare as the type options say, so can bisect the list.
+	if sorted && !modeGiven {
+		mode = searchExact
+	}
+	match, rc := i.searchMatcher(&c, mode, pat)
+	if rc != kTclOK {
+		return rc
+	}
+	var found []int
+	if sorted && mode == searchExact && !not && from < len(l) {
+		if found, rc = i.bisect(&c, l[from:], pat, decreasing, all); rc != kTclOK {
+			return rc
+		}
+		for ix := range found {
+			found[ix] += from
+		}
+	} else {
+		for ix := from; ix < len(l); ix++ {
+			v, rc := i.elemAt(l[ix], c.index)
+			if rc != kTclOK {
+				return rc
+			}
+			ok, rc := match(v)
+			if rc != kTclOK {
+				return rc
+			}
+			if ok != not {
+				found = append(found, ix)
+				if !all {
+					break
+				}
+			}
+		}
+	}
+	res := make([]*TclObj, len(found))
+	for ix, at := range found {
+		if inline {
+			res[ix] = l[at]
+		} else {
+			res[ix] = FromInt(at)
+		}
+	}
+	switch {
+	case all:
+		return i.Return(fromList(res))
+	case len(res) == 1:
+		return i.Return(res[0])
+	case inline:
+		return i.Return(kNil)
+	}
+	return i.Return(FromInt(-1))
+}
+
+// searchMatcher returns a function reporting whether an element matches
+// pat in the given mode.
+func (i *Interp) searchMatcher(c *listCompare, mode searchMode, pat *TclObj) (func(*TclObj) (bool, TclStatus), TclStatus) {
+	switch mode {
+	case searchGlob:
+		p := pat.AsString()
+		if c.nocase {
+			p = strings.ToLower(p)
+		}
+		return func(v *TclObj) (bool, TclStatus) {
+			s := v.AsString()
+			if c.nocase {
+				s = strings.ToLower(s)
+			}
+			return GlobMatch(p, s), kTclOK
+		}, kTclOK
+	case searchRegexp:
+		p := pat.AsString()
+		if c.nocase {
+			p = "(?i)" + p
+		}
+		re, e := regexp.Compile(p)
+		if e != nil {
+			return nil, i.FailStr("couldn't compile regular expression pattern: " + e.Error())
+		}
+		return func(v *TclObj) (bool, TclStatus) {
+			return re.MatchString(v.AsString()), kTclOK
+		}, kTclOK
+	}
+	pk, rc := c.keyOf(i, pat)
+	if rc != kTclOK {
+		return nil, rc
+	}
+	return func(v *TclObj) (bool, TclStatus) {
+		k, rc := c.keyOf(i, v)
+		if rc != kTclOK {
+			return false, rc
+		}
+		n, rc := c.compare(i, k, pk)
+		return n == 0, rc
+	}, kTclOK
+}
+
+// bisect returns the index of an element of l, sorted as c compares,
+// equal to pat, or of all of them, or none.
+func (i *Interp) bisect(c *listCompare, l []*TclObj, pat *TclObj, decreasing, all bool) ([]int, TclStatus) {
+	pk, rc := c.keyOf(i, pat)
+	if rc != kTclOK {
+		return nil, rc
+	}
+	// cmpAt compares the element at ix with pat, in the list's order.
+	cmpAt := func(ix int) (int, TclStatus) {
+		k, rc := c.key(i, l[ix])
+		if rc != kTclOK {
+			return 0, rc
+		}
+		n, rc := c.compare(i, k, pk)
+		if decreasing {
+			n = -n
+		}
+		return n, rc
+	}
+	// Find the first element not before pat.
+	lo, hi := 0, len(l)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		n, rc := cmpAt(mid)
+		if rc != kTclOK {
+			return nil, rc
+		}
+		if n < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	var found []int
+	for ix := lo; ix < len(l); ix++ {
+		n, rc := cmpAt(ix)
+		if rc != kTclOK {
+			return nil, rc
+		}
+		if n != 0 {
+			break
+		}
+		found = append(found, ix)
+		if !all {
+			break
+		}
+	}
+	return found, kTclOK
+}
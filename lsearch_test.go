@@ -0,0 +1,15 @@
+package gotcl
+
+import "testing"
+
+func TestLsearchErrors(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"lsearch {a}", `wrong # args: should be "lsearch ?-option value ...? list pattern"`},
+		{"lsearch -bogus {a} a", `bad option "-bogus": must be ` + lsearchOptions},
+		{"lsearch -start {a} a", "missing starting index"},
+		{"lsearch -start x {a} a", `bad index "x": must be integer?[+-]integer? or end?[+-]integer?`},
+		{"lsearch -exact -integer {a} 1", `expected integer but got "a"`},
+		{"lsearch -index 1 {a} a", `element 1 missing from sublist "a"`},
+		{"lsearch -regexp {a} (", "couldn't compile regular expression pattern: error parsing regexp: missing closing ): `(`"},
+	})
+}
@@ -0,0 +1,302 @@
+package gotcl
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A compareKind is how lsort and lsearch compare elements.
+type compareKind int
+
+const (
+	cmpAscii compareKind = iota
+	cmpDictionary
+	cmpInteger
+	cmpReal
+	cmpCommand
+)
+
+// An elemKey is an element, or the part of it selected by -index, in
+// the form it's compared in.
+type elemKey struct {
+	obj *TclObj
+	s   string
+	n   int64
+	f   float64
+}
+
+// A listCompare compares list elements as lsort's options ask.
+type listCompare struct {
+	kind   compareKind
+	nocase bool
+	index  []*TclObj // path to the part of each element to compare
+	cmd    []*TclObj // for cmpCommand
+}
+
+// elemAt returns the element of v at path, v and the lists in it being
+// indexed in turn.
+func (i *Interp) elemAt(v *TclObj, path []*TclObj) (*TclObj, TclStatus) {
+	for _, x := range path {
+		l, e := v.AsList()
+		if e != nil {
+			return nil, i.Fail(e)
+		}
+		at, rc := i.getIndex(x, len(l))
+		if rc != kTclOK {
+			return nil, rc
+		}
+		if at < 0 || at >= len(l) {
+			return nil, i.FailStr("element " + x.AsString() + " missing from sublist \"" + v.AsString() + "\"")
+		}
+		v = l[at]
+	}
+	return v, kTclOK
+}
+
+func (c *listCompare) key(i *Interp, v *TclObj) (elemKey, TclStatus) {
+	v, rc := i.elemAt(v, c.index)
+	if rc != kTclOK {
+		return elemKey{}, rc
+	}
+	return c.keyOf(i, v)
+}
+
+// keyOf returns v itself in the form it's compared in.
+func (c *listCompare) keyOf(i *Interp, v *TclObj) (elemKey, TclStatus) {
+	k := elemKey{obj: v}
+	var e error
+	switch c.kind {
+	case cmpAscii, cmpDictionary:
+		k.s = v.AsString()
+		if c.nocase {
+			k.s = strings.ToLower(k.s)
+		}
+	case cmpInteger:
+		k.n, e = v.AsInt64()
+	case cmpReal:
+		k.f, e = v.AsFloat()
+	}
+	if e != nil {
+		return elemKey{}, i.Fail(e)
+	}
+	return k, kTclOK
+}
+
+// compare returns how a compares with b: negative if it's before,
+// positive if after, and 0 if they're equal.
+func (c *listCompare) compare(i *Interp, a, b elemKey) (int, TclStatus) {
+	switch c.kind {
+	case cmpDictionary:
+		return dictCompare(a.s, b.s), kTclOK
+	case cmpInteger:
+		return cmp3(a.n < b.n, a.n > b.n), kTclOK
+	case cmpReal:
+		return cmp3(a.f < b.f, a.f > b.f), kTclOK
+	case cmpCommand:
+		cmdline := append(append([]*TclObj(nil), c.cmd...), a.obj, b.obj)
+		if rc := i.call(cmdline); rc != kTclOK {
+			return 0, rc
+		}
+		n, e := i.retval.AsInt()
+		if e != nil {
+			return 0, i.FailStr("-compare command returned non-integer result")
+		}
+		return n, kTclOK
+	}
+	return strings.Compare(a.s, b.s), kTclOK
+}
+
+func cmp3(less, more bool) int {
+	switch {
+	case less:
+		return -1
+	case more:
+		return 1
+	}
+	return 0
+}
+
+// dictCompare compares strings as lsort -dictionary does: ignoring case
+// except to break ties, and comparing runs of digits as integers.
+func dictCompare(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	tie := 0
+	for len(ar) > 0 && len(br) > 0 {
+		if unicode.IsDigit(ar[0]) && unicode.IsDigit(br[0]) {
+			// Leading zeros only break ties.
+			za, zb := 0, 0
+			for za < len(ar)-1 && ar[za] == '0' && unicode.IsDigit(ar[za+1]) {
+				za++
+			}
+			for zb < len(br)-1 && br[zb] == '0' && unicode.IsDigit(br[zb+1]) {
+				zb++
+			}
+			if tie == 0 {
+				tie = za - zb
+			}
+			ar, br = ar[za:], br[zb:]
+			na, nb := 0, 0
+			for na < len(ar) && unicode.IsDigit(ar[na]) {
+				na++
+			}
+			for nb < len(br) && unicode.IsDigit(br[nb]) {
+				nb++
+			}
+			if na != nb {
+				return na - nb
+			}
+			if c := strings.Compare(string(ar[:na]), string(br[:nb])); c != 0 {
+				return c
+			}
+			ar, br = ar[na:], br[nb:]
+			continue
+		}
+		la, lb := unicode.ToLower(ar[0]), unicode.ToLower(br[0])
+		if la != lb {
+			return int(la) - int(lb)
+		}
+		if tie == 0 && ar[0] != br[0] {
+			// Upper case comes first.
+			tie = cmp3(unicode.IsUpper(ar[0]), unicode.IsUpper(br[0]))
+		}
+		ar, br = ar[1:], br[1:]
+	}
+	if len(ar) != len(br) {
+		return len(ar) - len(br)
+	}
+	return tie
+}
+
+const lsortOptions = "-ascii, -command, -decreasing, -dictionary, -increasing, -index, -indices, -integer, -nocase, -real, -stride, or -unique"
+
+func tclLsort(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"lsort ?-option value ...? list\"")
+	}
+	var c listCompare
+	decreasing, unique, indices := false, false, false
+	stride := 1
+	opts, list := args[:len(args)-1], args[len(args)-1]
+	for len(opts) > 0 {
+		opt := opts[0].AsString()
+		opts = opts[1:]
+		switch opt {
+		case "-ascii":
+			c.kind = cmpAscii
+		case "-dictionary":
+			c.kind = cmpDictionary
+		case "-integer":
+			c.kind = cmpInteger
+		case "-real":
+			c.kind = cmpReal
+		case "-nocase":
+			c.nocase = true
+		case "-increasing":
+			decreasing = false
+		case "-decreasing":
+			decreasing = true
+		case "-unique":
+			unique = true
+		case "-indices":
+			indices = true
+		case "-index", "-command", "-stride":
+			if len(opts) == 0 {
+				what := map[string]string{
+					"-index": "list index", "-command": "comparison command", "-stride": "stride length",
+				}[opt]
+				return i.FailStr("\"" + opt + "\" option must be followed by " + what)
+			}
+			v := opts[0]
+			opts = opts[1:]
+			var e error
+			switch opt {
+			case "-index":
+				c.index, e = v.AsList()
+			case "-command":
+				c.kind = cmpCommand
+				c.cmd, e = v.AsList()
+			case "-stride":
+				if stride, e = v.AsInt(); e == nil && stride < 2 {
+					return i.FailStr("stride length must be at least 2")
+				}
+			}
+			if e != nil {
+				return i.Fail(e)
+			}
+		default:
+			return i.FailStr("bad option \"" + opt + "\": must be " + lsortOptions)
+		}
+	}
+	l, e := list.AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	if len(l)%stride != 0 {
+		return i.FailStr("list size must be a multiple of the stride length")
+	}
+	// Each group of stride elements is sorted by the key of the element
+	// the first -index picks, the rest of the index applying to it.
+	path := c.index
+	first := 0
+	if stride > 1 && len(path) > 0 {
+		at, rc := i.getIndex(path[0], stride)
+		if rc != kTclOK {
+			return rc
+		}
+		if at < 0 || at >= stride {
+			return i.FailStr("index \"" + path[0].AsString() + "\" out of range")
+		}
+		first, c.index = at, path[1:]
+	}
+	n := len(l) / stride
+	keys := make([]elemKey, n)
+	order := make([]int, n)
+	for ix := range keys {
+		k, rc := c.key(i, l[ix*stride+first])
+		if rc != kTclOK {
+			return rc
+		}
+		keys[ix], order[ix] = k, ix
+	}
+	rc := kTclOK
+	compare := func(a, b int) int {
+		if rc != kTclOK {
+			return 0
+		}
+		var res int
+		res, rc = c.compare(i, keys[a], keys[b])
+		if decreasing {
+			return -res
+		}
+		return res
+	}
+	sort.SliceStable(order, func(a, b int) bool { return compare(order[a], order[b]) < 0 })
+	if unique && len(order) > 0 {
+		// Of equal elements, the last is kept.
+		kept := order[:0]
+		for ix, o := range order {
+			if ix+1 < len(order) && compare(o, order[ix+1]) == 0 {
+				continue
+			}
+			kept = append(kept, o)
+		}
+		order = kept
+	}
+	if rc != kTclOK {
+		return rc
+	}
+	res := make([]*TclObj, 0, len(order)*stride)
+	for _, o := range order {
+		if indices {
+			res = append(res, FromInt(o*stride))
+		} else {
+			res = append(res, l[o*stride:(o+1)*stride]...)
+		}
+	}
+	return i.Return(fromList(res))
+}
+
+func init() {
+	RegisterDefaultCmd("lsort", tclLsort)
+}
@@ -0,0 +1,36 @@
+package gotcl
+
+import "testing"
+
+func TestLsortErrors(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"lsort", `wrong # args: should be "lsort ?-option value ...? list"`},
+		{"lsort -bogus {a}", `bad option "-bogus": must be ` + lsortOptions},
+		{"lsort -index {a}", `"-index" option must be followed by list index`},
+		{"lsort -integer {1 x}", `expected integer but got "x"`},
+		{"lsort -index 2 {{a b}}", `element 2 missing from sublist "a b"`},
+		{"lsort -stride 2 {a b c}", "list size must be a multiple of the stride length"},
+		{"lsort -command {concat x} {a b}", "-compare command returned non-integer result"},
+		{"lsort -command nosuch {a b}", "command not found: nosuch"},
+	})
+}
+
+func TestDictCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"a", "b", -1},
+		{"a2", "a10", -1},
+		{"A", "a", -1},
+		{"a", "A", 1},
+		{"x01", "x1", 1},
+		{"abc", "ABC", 1},
+		{"a", "ab", -1},
+	}
+	for _, test := range tests {
+		if got := cmp3(dictCompare(test.a, test.b) < 0, dictCompare(test.a, test.b) > 0); got != test.want {
+			t.Errorf("%q %q: got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gotcl
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// An object is a Go struct exposed to scripts as a command.
+type object struct {
+	v       reflect.Value // the struct pointed to, or invalid once deleted
+	methods map[string]TclCmd
+}
+
+// NewObjectCmd makes the struct v points to available as the command
+// name. Its exported methods become subcommands, bound as by BindFunc,
+// and its exported fields can be read with "name cget -Field" and set
+// with "name configure -Field value ?-Field value ...?". When the
+// command is deleted, i drops its references to v, first calling its
+// Close method if it's an io.Closer.
+func (i *Interp) NewObjectCmd(name string, v interface{}) error {
+	pv := reflect.ValueOf(v)
+	if pv.Kind() != reflect.Ptr || pv.Elem().Kind() != reflect.Struct {
+		return errors.New("object must be a pointer to a struct")
+	}
+	o := &object{v: pv.Elem(), methods: make(map[string]TclCmd)}
+	for ix := 0; ix < pv.NumMethod(); ix++ {
+		m := pv.Type().Method(ix)
+		if cmd, e := BindFunc("", pv.Method(ix).Interface()); e == nil {
+			o.methods[m.Name] = cmd
+		}
+	}
+	o.methods["cget"] = o.cget
+	o.methods["configure"] = o.configure
+	i.SetCmd(name, o.call)
+	i.SetCmdDeleter(name, func() {
+		if c, ok := v.(io.Closer); ok {
+			c.Close()
+		}
+		o.v = reflect.Value{}
+		o.methods = nil
+	})
+	return nil
+}
+
+// call runs a method. Usage messages name the object by the word it
+// was called with, since it may have been renamed.
+func (o *object) call(i *Interp, args []*TclObj) TclStatus {
+	word := i.cmdname
+	if !o.v.IsValid() {
+		// Still reachable after the command was deleted, as a hidden
+		// command can be.
+		return i.FailStr("object \"" + word + "\" has been deleted")
+	}
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"" + word + " method ?arg ...?\"")
+	}
+	i.cmdname = word + " " + args[0].AsString()
+	return doEnsemble(o.methods, args[0].AsString(), i, args[1:])
+}
+
+// field returns the exported field named by an option like -Field.
+func (o *object) field(opt *TclObj) (reflect.Value, error) {
+	name := strings.TrimPrefix(opt.AsString(), "-")
+	if f, ok := o.v.Type().FieldByName(name); ok && f.IsExported() && name != opt.AsString() {
+		return o.v.FieldByIndex(f.Index), nil
+	}
+	return reflect.Value{}, errors.New("unknown option \"" + opt.AsString() + "\"")
+}
+
+func (o *object) get(opt *TclObj) (*TclObj, error) {
+	f, e := o.field(opt)
+	if e != nil {
+		return nil, e
+	}
+	conv, e := resultConverter(f.Type())
+	if e != nil {
+		return nil, e
+	}
+	return conv(f), nil
+}
+
+func (o *object) cget(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"" + i.cmdname + " option\"")
+	}
+	v, e := o.get(args[0])
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(v)
+}
+
+func (o *object) configure(i *Interp, args []*TclObj) TclStatus {
+	switch len(args) {
+	case 0:
+		var l []*TclObj
+		t := o.v.Type()
+		for ix := 0; ix < t.NumField(); ix++ {
+			if f := t.Field(ix); f.IsExported() && !f.Anonymous {
+				opt := FromStr("-" + f.Name)
+				if v, e := o.get(opt); e == nil {
+					l = append(l, opt, v)
+				}
+			}
+		}
+		return i.Return(fromList(l))
+	case 1:
+		return o.cget(i, args)
+	}
+	if len(args)%2 != 0 {
+		return i.FailStr("value for \"" + args[len(args)-1].AsString() + "\" missing")
+	}
+	for ix := 0; ix < len(args); ix += 2 {
+		f, e := o.field(args[ix])
+		if e != nil {
+			return i.Fail(e)
+		}
+		conv, e := argConverter(f.Type())
+		if e != nil {
+			return i.Fail(e)
+		}
+		v, e := conv(args[ix+1])
+		if e != nil {
+			return i.Fail(e)
+		}
+		f.Set(v)
+	}
+	return i.Return(kNil)
+}
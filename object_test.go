@@ -0,0 +1,90 @@
+package gotcl
+
+import (
+	"errors"
+	"testing"
+)
+
+type store struct {
+	Name   string
+	Limit  int
+	Tags   []string
+	data   map[string]string
+	closed bool
+}
+
+func (s *store) Put(k, v string) error {
+	if len(s.data) >= s.Limit {
+		return errors.New("store is full")
+	}
+	s.data[k] = v
+	return nil
+}
+
+func (s *store) Get(k string) (string, bool) {
+	v, ok := s.data[k]
+	return v, ok
+}
+
+func (s *store) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestObjectCmd(t *testing.T) {
+	i := NewInterp()
+	s := &store{Name: "main", Limit: 1, data: make(map[string]string)}
+	if e := i.NewObjectCmd("db1", s); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := i.EvalString("db1 Put a"); e == nil || e.Error() != `wrong # args: should be "db1 Put string string"` {
+		t.Errorf("got %v", e)
+	}
+	for _, c := range []struct{ script, want string }{
+		{"db1 Put a 1", ""},
+		{"db1 Get a", "1 1"},
+		{"db1 Get b", "{} 0"},
+		{"db1 cget -Name", "main"},
+		{"db1 configure -Limit 2 -Tags {x y}", ""},
+		{"db1 Put b 2; db1 cget -Limit", "2"},
+		{"db1 configure", "-Name main -Limit 2 -Tags {x y}"},
+		{"rename db1 db2; db2 Get b", "2 1"},
+	} {
+		v, e := i.EvalString(c.script)
+		if e != nil || v.AsString() != c.want {
+			t.Errorf("%s: got %v, %v; want %s", c.script, v, e, c.want)
+		}
+	}
+	for _, c := range []struct{ script, want string }{
+		{"db2 Put c 3", "store is full"},
+		{"db2 cget -data", `unknown option "-data"`},
+		{"db2 configure -Limit x", `expected integer but got "x"`},
+		{"db2 Nope", `unknown or ambiguous subcommand "Nope". Must be Close, Get, Put, cget, or configure.`},
+		{"db2 Put c", `wrong # args: should be "db2 Put string string"`},
+		{"db2 cget", `wrong # args: should be "db2 cget option"`},
+	} {
+		_, e := i.EvalString(c.script)
+		if e == nil || e.Error() != c.want {
+			t.Errorf("%s: got error %v; want %s", c.script, e, c.want)
+		}
+	}
+	if s.closed {
+		t.Fatal("closed by rename")
+	}
+	if _, e := i.EvalString("interp hide {} db2; interp expose {} db2; db2 cget -Name"); e == nil || e.Error() != `object "db2" has been deleted` {
+		t.Fatalf("hidden and exposed: got %v", e)
+	}
+	s.closed = false
+	if e := i.NewObjectCmd("db2", s); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := i.EvalString("rename db2 {}"); e != nil {
+		t.Fatal(e)
+	}
+	if !s.closed {
+		t.Fatal("not closed when deleted")
+	}
+	if _, e := i.EvalString("db2 Get a"); e == nil {
+		t.Fatal("deleted command still works")
+	}
+}
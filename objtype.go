@@ -0,0 +1,110 @@
+package gotcl
+
+// An ObjType is a kind of internal representation that Go code can
+// cache on a TclObj, alongside the integer and list reps built in. An
+// object holds at most one rep of a custom type at a time: converting
+// it to another type frees the old rep, as long as the string form
+// can be regenerated from it first.
+type ObjType interface {
+	// Name identifies the type: reps of types with the same name are
+	// taken to be of the same type, so it must be unique.
+	Name() string
+	// UpdateString returns the string form of rep.
+	UpdateString(rep interface{}) string
+	// SetFromAny parses the string form of obj into a rep.
+	SetFromAny(obj *TclObj) (interface{}, error)
+	// Dup returns a copy of rep for a duplicate of its object.
+	Dup(rep interface{}) interface{}
+	// Free releases rep once its object no longer holds it.
+	Free(rep interface{})
+}
+
+type customRep struct {
+	typ ObjType
+	rep interface{}
+}
+
+// NewObj returns an object holding rep, a rep of type typ. Its string
+// form is made by typ when it's needed.
+func NewObj(typ ObjType, rep interface{}) *TclObj {
+	t := new(TclObj)
+	t.ownReps().custom.Store(&customRep{typ, rep})
+	return t
+}
+
+// Type returns the type of t's custom rep, or nil if it has none.
+func (t *TclObj) Type() ObjType {
+	if c := t.reps().custom.Load(); c != nil {
+		return c.typ
+	}
+	return nil
+}
+
+// ConvertTo returns t's rep of type typ, making it from t's string
+// form with typ.SetFromAny if t doesn't already hold one.
+func (t *TclObj) ConvertTo(typ ObjType) (interface{}, error) {
+	if c := t.reps().custom.Load(); c != nil && c.typ.Name() == typ.Name() {
+		return c.rep, nil
+	}
+	rep, e := typ.SetFromAny(t)
+	if e != nil {
+		return nil, e
+	}
+	t.SetRep(typ, rep)
+	return rep, nil
+}
+
+// SetRep makes rep, of type typ, t's custom rep, freeing any it held
+// before. The caller is responsible for rep matching t's string form.
+func (t *TclObj) SetRep(typ ObjType, rep interface{}) {
+	t.AsString()
+	if old := t.ownReps().custom.Swap(&customRep{typ, rep}); old != nil {
+		old.typ.Free(old.rep)
+	}
+}
+
+// InvalidateString drops t's string form, and the other reps made from
+// it, so they're made afresh from its custom rep when they're next
+// needed. Call it after changing the rep in place, which is only safe
+// while nothing else holds t. It does nothing if t has no custom rep.
+func (t *TclObj) InvalidateString() {
+	r := t.reps()
+	if r.custom.Load() == nil {
+		return
+	}
+	t.value.Store(nil)
+	t.has_intval.Store(false)
+	t.tailFree.Store(false)
+	t.listval.Store(nil)
+	r.cmdsval.Store(nil)
+	r.vrefval.Store(nil)
+	r.exprval.Store(nil)
+	r.codeval.Store(nil)
+	r.procval.Store(nil)
+	r.indexval.Store(nil)
+	r.dictval.Store(nil)
+}
+
+// Duplicate returns a new object equal to t, with a copy of any custom
+// rep t holds, so the copy's rep can be changed without affecting t.
+func (t *TclObj) Duplicate() *TclObj {
+	d := new(TclObj)
+	if v := t.value.Load(); v != nil {
+		d.value.Store(v)
+	}
+	if t.has_intval.Load() {
+		d.intval.Store(t.intval.Load())
+		d.has_intval.Store(true)
+	}
+	if l := t.listval.Load(); l != nil {
+		items := append([]*TclObj(nil), *l...)
+		d.listval.Store(&items)
+	}
+	if dv := t.reps().dictval.Load(); dv != nil {
+		d.ownReps().dictval.Store(dv)
+	}
+	if c := t.reps().custom.Load(); c != nil {
+		d.ownReps().custom.Store(&customRep{c.typ, c.typ.Dup(c.rep)})
+	}
+	return d
+}
@@ -0,0 +1,110 @@
+package gotcl
+
+import (
+	"fmt"
+	"testing"
+)
+
+type point struct{ x, y int }
+
+type pointType struct{ parses, frees int }
+
+func (pt *pointType) Name() string { return "point" }
+
+func (pt *pointType) UpdateString(rep interface{}) string {
+	p := rep.(*point)
+	return fmt.Sprintf("%d,%d", p.x, p.y)
+}
+
+func (pt *pointType) SetFromAny(obj *TclObj) (interface{}, error) {
+	pt.parses++
+	p := new(point)
+	if _, e := fmt.Sscanf(obj.AsString(), "%d,%d", &p.x, &p.y); e != nil {
+		return nil, fmt.Errorf("expected point but got %q", obj.AsString())
+	}
+	return p, nil
+}
+
+func (pt *pointType) Dup(rep interface{}) interface{} {
+	p := *rep.(*point)
+	return &p
+}
+
+func (pt *pointType) Free(rep interface{}) { pt.frees++ }
+
+func TestObjType(t *testing.T) {
+	pt := &pointType{}
+	i := NewInterp()
+	i.SetCmd("px", func(i *Interp, args []*TclObj) TclStatus {
+		p, e := args[0].ConvertTo(pt)
+		if e != nil {
+			return i.Fail(e)
+		}
+		return i.Return(FromInt(p.(*point).x))
+	})
+	v, e := i.EvalString("set p 3,4\nfor {set n 0} {$n < 10} {incr n} { px $p }\npx $p")
+	if e != nil || v.AsString() != "3" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if pt.parses != 1 {
+		t.Fatalf("parsed %d times, want 1", pt.parses)
+	}
+	if _, e := i.EvalString("px nope"); e == nil {
+		t.Fatal("expected conversion error")
+	}
+
+	obj := NewObj(pt, &point{1, 2})
+	if obj.AsString() != "1,2" || obj.Type() != pt {
+		t.Fatalf("bad string %q or type", obj.AsString())
+	}
+	dup := obj.Duplicate()
+	rep, _ := dup.ConvertTo(pt)
+	rep.(*point).x = 5
+	if orig, _ := obj.ConvertTo(pt); orig.(*point).x != 1 {
+		t.Fatal("duplicate shares its rep")
+	}
+	obj.SetRep(otherType{}, nil)
+	if pt.frees != 1 || obj.AsString() != "1,2" {
+		t.Fatalf("shimmering lost the string or didn't free: %d %q", pt.frees, obj.AsString())
+	}
+}
+
+func TestInvalidateString(t *testing.T) {
+	pt := &pointType{}
+	obj := NewObj(pt, &point{1, 2})
+	if l, e := obj.AsList(); e != nil || len(l) != 1 {
+		t.Fatalf("AsList = %v, %v", l, e)
+	}
+	rep, _ := obj.ConvertTo(pt)
+	rep.(*point).x = 7
+	obj.InvalidateString()
+	if obj.AsString() != "7,2" {
+		t.Fatalf("got %q after invalidating", obj.AsString())
+	}
+}
+
+// tagsType isn't comparable, so types must be told apart some other way.
+type tagsType struct{ tags []string }
+
+func (tagsType) Name() string                                { return "tags" }
+func (tagsType) UpdateString(rep interface{}) string         { return rep.(string) }
+func (tagsType) SetFromAny(obj *TclObj) (interface{}, error) { return obj.AsString(), nil }
+func (tagsType) Dup(rep interface{}) interface{}             { return rep }
+func (tagsType) Free(rep interface{})                        {}
+
+func TestUncomparableObjType(t *testing.T) {
+	obj := FromStr("a")
+	for n := 0; n < 2; n++ {
+		if rep, e := obj.ConvertTo(tagsType{[]string{"x"}}); e != nil || rep != "a" {
+			t.Fatalf("ConvertTo = %v, %v", rep, e)
+		}
+	}
+}
+
+type otherType struct{}
+
+func (otherType) Name() string                                { return "other" }
+func (otherType) UpdateString(rep interface{}) string         { return "" }
+func (otherType) SetFromAny(obj *TclObj) (interface{}, error) { return nil, nil }
+func (otherType) Dup(rep interface{}) interface{}             { return rep }
+func (otherType) Free(rep interface{})                        {}
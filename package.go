@@ -0,0 +1,467 @@
+package gotcl
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A version is a package version: non-negative integers separated by
+// dots.
+type version []int
+
+func parseVersion(s string) (version, error) {
+	parts := strings.Split(s, ".")
+	v := make(version, len(parts))
+	for ix, p := range parts {
+		n, e := strconv.Atoi(p)
+		if e != nil || n < 0 || p[0] == '+' {
+			return nil, errors.New("expected version number but got \"" + s + "\"")
+		}
+		v[ix] = n
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 as v is older than, the same as or newer
+// than w. A version that is a prefix of another is older, as in Tcl.
+func (v version) compare(w version) int {
+	for ix := 0; ix < len(v) && ix < len(w); ix++ {
+		if v[ix] != w[ix] {
+			if v[ix] < w[ix] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(v) < len(w):
+		return -1
+	case len(v) > len(w):
+		return 1
+	}
+	return 0
+}
+
+// satisfies reports whether v meets the requirement req, which is
+// "min", met by versions no older than min with its major number;
+// "min-", met by versions no older than min; or "min-max", met by
+// versions no older than min and older than max.
+func (v version) satisfies(req string) (bool, error) {
+	lo, hi, ranged := strings.Cut(req, "-")
+	min, e := parseVersion(lo)
+	if e != nil {
+		return false, e
+	}
+	if v.compare(min) < 0 {
+		return false, nil
+	}
+	if !ranged {
+		return v[0] == min[0], nil
+	}
+	if hi == "" {
+		return true, nil
+	}
+	max, e := parseVersion(hi)
+	if e != nil {
+		return false, e
+	}
+	return v.compare(max) < 0, nil
+}
+
+// satisfiesAll reports whether the version s meets any of reqs, or
+// equals reqs[0] if exact is set. It's true if there are no reqs.
+func satisfiesAll(s string, exact bool, reqs []string) (bool, error) {
+	v, e := parseVersion(s)
+	if e != nil || len(reqs) == 0 {
+		return e == nil, e
+	}
+	if exact {
+		w, e := parseVersion(reqs[0])
+		return e == nil && v.compare(w) == 0, e
+	}
+	for _, r := range reqs {
+		if ok, e := v.satisfies(r); ok || e != nil {
+			return ok, e
+		}
+	}
+	return false, nil
+}
+
+// A pkg is what an interp knows about a package.
+type pkg struct {
+	provided string             // the version loaded, if any
+	ifneeded map[string]*TclObj // scripts to load versions
+	loading  bool
+}
+
+func (p *pkg) clone() *pkg {
+	np := &pkg{provided: p.provided, ifneeded: make(map[string]*TclObj, len(p.ifneeded))}
+	for v, s := range p.ifneeded {
+		np.ifneeded[v] = s
+	}
+	return np
+}
+
+// copyPkgs gives i copies of what src knows about packages.
+func (i *Interp) copyPkgs(src *Interp) {
+	i.pkgs, i.pkgIndexed = nil, nil
+	if src.pkgs != nil {
+		i.pkgs = make(map[string]*pkg, len(src.pkgs))
+		for n, p := range src.pkgs {
+			i.pkgs[n] = p.clone()
+		}
+	}
+	if src.pkgIndexed != nil {
+		i.pkgIndexed = make(map[string]bool, len(src.pkgIndexed))
+		for f := range src.pkgIndexed {
+			i.pkgIndexed[f] = true
+		}
+	}
+}
+
+// Packages compiled in with RegisterPackage, by name and version.
+var goPackages = make(map[string]map[string]func(*Interp) error)
+
+// RegisterPackage makes version ver of the package name available to
+// all interps. The first time a script requires it, load is called to
+// set it up, after which the package is provided.
+// Should be called from init().
+func RegisterPackage(name, ver string, load func(*Interp) error) {
+	if _, e := parseVersion(ver); e != nil {
+		panic(e)
+	}
+	if goPackages[name] == nil {
+		goPackages[name] = make(map[string]func(*Interp) error)
+	}
+	goPackages[name][ver] = load
+}
+
+func (i *Interp) pkg(name string) *pkg {
+	p, ok := i.pkgs[name]
+	if !ok {
+		if i.pkgs == nil {
+			i.pkgs = make(map[string]*pkg)
+		}
+		p = &pkg{ifneeded: make(map[string]*TclObj)}
+		i.pkgs[name] = p
+	}
+	return p
+}
+
+// pkgVersions returns the versions of name that can be loaded, oldest
+// first.
+func (i *Interp) pkgVersions(name string) []string {
+	seen := make(map[string]bool)
+	var vs []string
+	add := func(v string) {
+		if !seen[v] {
+			seen[v] = true
+			vs = append(vs, v)
+		}
+	}
+	if p, ok := i.pkgs[name]; ok {
+		for v := range p.ifneeded {
+			add(v)
+		}
+	}
+	for v := range goPackages[name] {
+		add(v)
+	}
+	sort.Slice(vs, func(a, b int) bool {
+		va, _ := parseVersion(vs[a])
+		vb, _ := parseVersion(vs[b])
+		return va.compare(vb) < 0
+	})
+	return vs
+}
+
+// bestVersion returns the newest version of name that can be loaded
+// and meets the requirements, or "" if there is none.
+func (i *Interp) bestVersion(name string, exact bool, reqs []string) (string, error) {
+	vs := i.pkgVersions(name)
+	for ix := len(vs) - 1; ix >= 0; ix-- {
+		ok, e := satisfiesAll(vs[ix], exact, reqs)
+		if e != nil {
+			return "", e
+		}
+		if ok {
+			return vs[ix], nil
+		}
+	}
+	return "", nil
+}
+
+// require loads a version of the package name that meets reqs, if one
+// isn't already, returning the version provided.
+func (i *Interp) require(name string, exact bool, reqs []string) (string, TclStatus) {
+	p := i.pkg(name)
+	if p.provided != "" {
+		ok, e := satisfiesAll(p.provided, exact, reqs)
+		if e != nil {
+			return "", i.Fail(e)
+		}
+		if !ok {
+			return "", i.FailStr("version conflict for package \"" + name + "\": have " +
+				p.provided + ", need " + strings.Join(reqs, " "))
+		}
+		return p.provided, kTclOK
+	}
+	ver, e := i.bestVersion(name, exact, reqs)
+	if e == nil && ver == "" {
+		if rc := i.loadPkgIndexes(); rc != kTclOK {
+			return "", rc
+		}
+		ver, e = i.bestVersion(name, exact, reqs)
+	}
+	if e != nil {
+		return "", i.Fail(e)
+	}
+	if ver == "" {
+		return "", i.FailStr(strings.TrimSpace("can't find package " + name + " " + strings.Join(reqs, " ")))
+	}
+	if p.loading {
+		return "", i.FailStr("circular package dependency: attempt to provide " +
+			name + " " + ver + " requires " + name)
+	}
+	p.loading = true
+	defer func() { p.loading = false }()
+	if script, ok := p.ifneeded[ver]; ok {
+		saved := i.frame
+		i.frame = i.varFrame(true)
+		rc := i.EvalObj(script)
+		i.frame = saved
+		if rc != kTclOK && rc != kTclReturn {
+			return "", rc
+		}
+	} else {
+		if e := goPackages[name][ver](i); e != nil {
+			return "", i.Fail(e)
+		}
+		if p.provided == "" {
+			p.provided = ver
+		}
+	}
+	if p.provided == "" {
+		return "", i.FailStr("attempt to provide package " + name + " " + ver +
+			" failed: no version of package " + name + " provided")
+	}
+	return p.provided, kTclOK
+}
+
+// loadPkgIndexes sources the pkgIndex.tcl files in the directories on
+// auto_path and their subdirectories that haven't been sourced yet.
+// Each runs with dir set to its directory.
+func (i *Interp) loadPkgIndexes() TclStatus {
+	if i.safe {
+		return kTclOK
+	}
+	path, e := i.getVar(toVarRef("::auto_path"))
+	if e != nil {
+		return kTclOK
+	}
+	dirs, e := path.AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	for _, d := range dirs {
+		cands := []string{d.AsString()}
+		if ents, e := i.FS().ReadDir(d.AsString()); e == nil {
+			for _, ent := range ents {
+				if ent.IsDir() {
+					cands = append(cands, joinName(d.AsString(), ent.Name()))
+				}
+			}
+		}
+		for _, dir := range cands {
+			fname := joinName(dir, "pkgIndex.tcl")
+			if i.pkgIndexed[fname] {
+				continue
+			}
+			ok, rc := i.sourceInDir(fname, FromStr(dir))
+			if ok {
+				if i.pkgIndexed == nil {
+					i.pkgIndexed = make(map[string]bool)
+				}
+				i.pkgIndexed[fname] = true
+			}
+			if rc != kTclOK {
+				return rc
+			}
+		}
+	}
+	return kTclOK
+}
+
+// pkgArgs splits the arguments of require and present into the package
+// name, whether -exact was given, and the requirements.
+func pkgArgs(args []*TclObj) (string, bool, []string, bool) {
+	exact := len(args) > 0 && args[0].AsString() == "-exact"
+	if exact {
+		args = args[1:]
+	}
+	if len(args) == 0 || (exact && len(args) != 2) {
+		return "", false, nil, false
+	}
+	var reqs []string
+	for _, r := range args[1:] {
+		reqs = append(reqs, r.AsString())
+	}
+	return args[0].AsString(), exact, reqs, true
+}
+
+func pkgRequire(i *Interp, args []*TclObj) TclStatus {
+	name, exact, reqs, ok := pkgArgs(args)
+	if !ok {
+		return i.FailStr("wrong # args: should be \"package require ?-exact? package ?requirement ...?\"")
+	}
+	ver, rc := i.require(name, exact, reqs)
+	if rc != kTclOK {
+		return rc
+	}
+	return i.Return(FromStr(ver))
+}
+
+func pkgPresent(i *Interp, args []*TclObj) TclStatus {
+	name, exact, reqs, ok := pkgArgs(args)
+	if !ok {
+		return i.FailStr("wrong # args: should be \"package present ?-exact? package ?requirement ...?\"")
+	}
+	if p, found := i.pkgs[name]; found && p.provided != "" {
+		ok, e := satisfiesAll(p.provided, exact, reqs)
+		if e != nil {
+			return i.Fail(e)
+		}
+		if ok {
+			return i.Return(FromStr(p.provided))
+		}
+		return i.FailStr("version conflict for package \"" + name + "\": have " +
+			p.provided + ", need " + strings.Join(reqs, " "))
+	}
+	return i.FailStr("package " + name + " is not present")
+}
+
+func pkgProvide(i *Interp, args []*TclObj) TclStatus {
+	switch len(args) {
+	case 1:
+		if p, ok := i.pkgs[args[0].AsString()]; ok {
+			return i.Return(FromStr(p.provided))
+		}
+		return i.Return(kNil)
+	case 2:
+		name, ver := args[0].AsString(), args[1].AsString()
+		if _, e := parseVersion(ver); e != nil {
+			return i.Fail(e)
+		}
+		p := i.pkg(name)
+		if p.provided != "" && p.provided != ver {
+			return i.FailStr("conflicting versions provided for package \"" + name + "\": " +
+				p.provided + ", then " + ver)
+		}
+		p.provided = ver
+		return i.Return(kNil)
+	}
+	return i.FailStr("wrong # args: should be \"package provide package ?version?\"")
+}
+
+func pkgIfneeded(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 2 && len(args) != 3 {
+		return i.FailStr("wrong # args: should be \"package ifneeded package version ?script?\"")
+	}
+	name, ver := args[0].AsString(), args[1].AsString()
+	if _, e := parseVersion(ver); e != nil {
+		return i.Fail(e)
+	}
+	if len(args) == 2 {
+		if p, ok := i.pkgs[name]; ok && p.ifneeded[ver] != nil {
+			return i.Return(p.ifneeded[ver])
+		}
+		return i.Return(kNil)
+	}
+	i.pkg(name).ifneeded[ver] = args[2]
+	return i.Return(kNil)
+}
+
+func pkgVersions(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"package versions package\"")
+	}
+	return i.Return(FromList(i.pkgVersions(args[0].AsString())))
+}
+
+func pkgNames(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 0 {
+		return i.FailStr("wrong # args: should be \"package names\"")
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for n, p := range i.pkgs {
+		if p.provided != "" || len(p.ifneeded) != 0 {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	for n := range goPackages {
+		if !seen[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return i.Return(FromList(names))
+}
+
+// pkgForget removes what i knows of each package. Those registered
+// from Go stay available, and are loaded again if required again.
+func pkgForget(i *Interp, args []*TclObj) TclStatus {
+	for _, a := range args {
+		delete(i.pkgs, a.AsString())
+	}
+	return i.Return(kNil)
+}
+
+func pkgVcompare(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 2 {
+		return i.FailStr("wrong # args: should be \"package vcompare version1 version2\"")
+	}
+	v, e := parseVersion(args[0].AsString())
+	if e != nil {
+		return i.Fail(e)
+	}
+	w, e := parseVersion(args[1].AsString())
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(FromInt(v.compare(w)))
+}
+
+func pkgVsatisfies(i *Interp, args []*TclObj) TclStatus {
+	if len(args) < 2 {
+		return i.FailStr("wrong # args: should be \"package vsatisfies version ?requirement ...?\"")
+	}
+	var reqs []string
+	for _, r := range args[1:] {
+		reqs = append(reqs, r.AsString())
+	}
+	ok, e := satisfiesAll(args[0].AsString(), false, reqs)
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(FromBool(ok))
+}
+
+var packageEn = ensembleSpec{
+	"forget":     pkgForget,
+	"ifneeded":   pkgIfneeded,
+	"names":      pkgNames,
+	"present":    pkgPresent,
+	"provide":    pkgProvide,
+	"require":    pkgRequire,
+	"vcompare":   pkgVcompare,
+	"versions":   pkgVersions,
+	"vsatisfies": pkgVsatisfies,
+}
+
+func init() {
+	RegisterDefaultCmd("package", packageEn.makeCmd())
+}
@@ -0,0 +1,77 @@
+package gotcl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageVersions(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"package vcompare 1.a 1", `expected version number but got "1.a"`},
+	})
+}
+
+func TestPackage(t *testing.T) {
+	i := NewInterp()
+	if _, e := i.EvalString(`
+		package ifneeded foo 1.5 {package provide foo 1.5}
+		package ifneeded bar 1 {}
+		package ifneeded loop 1 {package require loop}`); e != nil {
+		t.Fatal(e)
+	}
+	checkScripts(t, i, []scriptTest{
+		{"package require nosuch", "can't find package nosuch"},
+		{"package present foo", "package foo is not present"},
+		{"package require foo\npackage require foo 2", `version conflict for package "foo": have 1.5, need 2`},
+		{"package provide foo 2.1", `conflicting versions provided for package "foo": 1.5, then 2.1`},
+		{"package require bar", "attempt to provide package bar 1 failed: no version of package bar provided"},
+		{"package require loop", "circular package dependency: attempt to provide loop 1 requires loop"},
+	})
+}
+
+func TestPackageIndex(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "greet1.2")
+	files := map[string]string{
+		filepath.Join(sub, "pkgIndex.tcl"): "package ifneeded greet 1.2 [list source \"$dir/greet.tcl\"]\n",
+		filepath.Join(sub, "greet.tcl"):    "package provide greet 1.2\nproc greet {} { return hello }\n",
+	}
+	if e := os.Mkdir(sub, 0777); e != nil {
+		t.Fatal(e)
+	}
+	for name, body := range files {
+		if e := os.WriteFile(name, []byte(body), 0666); e != nil {
+			t.Fatal(e)
+		}
+	}
+	i := NewInterp()
+	i.SetVarRaw("d", FromStr(dir))
+	checkScripts(t, i, []scriptTest{
+		{"package require greet", "can't find package greet"},
+		{"set auto_path [list $d]\npackage require greet 1", "1.2"},
+		{"greet", "hello"},
+	})
+}
+
+func init() {
+	RegisterPackage("gopkg", "0.9", func(i *Interp) error {
+		return nil
+	})
+	RegisterPackage("gopkg", "1.1", func(i *Interp) error {
+		i.SetCmd("gopkg::hello", func(i *Interp, args []*TclObj) TclStatus {
+			return i.Return(FromStr("hello from go"))
+		})
+		return nil
+	})
+}
+
+func TestGoPackage(t *testing.T) {
+	checkScripts(t, NewInterp(), []scriptTest{
+		{"info commands gopkg::*", ""},
+		{"package versions gopkg", "0.9 1.1"},
+		{"package require gopkg", "1.1"},
+		{"gopkg::hello", "hello from go"},
+		{"package present gopkg 1", "1.1"},
+	})
+}
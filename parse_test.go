@@ -26,6 +26,27 @@ func TestListParse(t *testing.T) {
 	}
 }
 
+func TestListRoundTrip(t *testing.T) {
+	elems := []string{"", "a b", "{", "}x", "a\\", "$v", "[c]", "\"q\"", "#x", "a;b", "x\ny", "{a} {b"}
+	items := make([]*TclObj, len(elems))
+	for ix, s := range elems {
+		items[ix] = FromStr(s)
+	}
+	str := fromList(items).AsString()
+	back, e := FromStr(str).AsList()
+	if e != nil {
+		t.Fatalf("%q: %v", str, e)
+	}
+	if len(back) != len(elems) {
+		t.Fatalf("%q: got %d elements, want %d", str, len(back), len(elems))
+	}
+	for ix, s := range elems {
+		if got := back[ix].AsString(); got != s {
+			t.Errorf("element %d of %q: got %q, want %q", ix, str, got, s)
+		}
+	}
+}
+
 func verifyParse(t *testing.T, code string) {
 	_, e := parseCommands(strings.NewReader(code))
 	if e != nil {
@@ -11,11 +11,22 @@ type parser struct {
 	data   io.RuneReader
 	tmpbuf *bytes.Buffer
 	ch     rune
+	// Where ch is, for placing commands and the scripts in braces.
+	file string
+	line int
+}
+
+// A srcPos is where a script came from: the file, if it was read from
+// one, and the line it starts on.
+type srcPos struct {
+	file string
+	line int
 }
 
 func newParser(input io.RuneReader) *parser {
 	p := &parser{data: input, tmpbuf: bytes.NewBuffer(make([]byte, 0, 1024))}
 	p.advance()
+	p.line = 1
 	return p
 }
 
@@ -33,6 +44,9 @@ func (p *parser) advance() (result rune) {
 		p.fail("unexpected EOF")
 	}
 	result = p.ch
+	if result == '\n' {
+		p.line++
+	}
 	r, _, e := p.data.ReadRune()
 	if e != nil {
 		if e != io.EOF {
@@ -114,10 +128,11 @@ func (p *parser) parseSimpleWordTil(til rune) *tliteral {
 	if len(res) == 0 {
 		p.expectFailed("word", p.ch)
 	}
-	return &tliteral{strval: res}
+	return newLiteral(res)
 }
 
 func (p *parser) parseSubcommand() *subcommand {
+	line := p.line
 	p.consumeRune('[')
 	res := make([]tclTok, 0, 16)
 	p.eatWhile(issepspace)
@@ -126,7 +141,7 @@ func (p *parser) parseSubcommand() *subcommand {
 		p.eatWhile(issepspace)
 	}
 	p.consumeRune(']')
-	return &subcommand{cmd: makeCommand(res)}
+	return &subcommand{cmd: p.makeCommand(res, line)}
 }
 
 func (p *parser) parseBlockData() string {
@@ -164,18 +179,34 @@ func (p *parser) checkForExtraChars() {
 }
 
 func (p *parser) parseBlock() *block {
+	line := p.line
 	bd := p.parseBlockData()
 	p.checkForExtraChars()
-	return &block{strval: bd}
+	return p.newBlock(bd, line)
 }
 
 func (p *parser) parseBlockOrExpand() tclTok {
+	line := p.line
 	bd := p.parseBlockData()
 	if bd == "*" && p.hasExtraChars() {
 		return &expandTok{p.parseToken()}
 	}
 	p.checkForExtraChars()
-	return &block{strval: bd}
+	return p.newBlock(bd, line)
+}
+
+// newBlock returns a block starting on line, which remembers where it
+// is in case it's a script.
+func (p *parser) newBlock(s string, line int) *block {
+	b := newBlock(s)
+	b.tval.src = &srcPos{p.file, line}
+	return b
+}
+
+func (p *parser) makeCommand(words []tclTok, line int) command {
+	c := makeCommand(words)
+	c.pos = srcPos{p.file, line}
+	return c
 }
 
 func (p *parser) parseVariable() varRef {
@@ -328,6 +359,7 @@ Loop:
 }
 
 func (p *parser) parseCommand() command {
+	line := p.line
 	res := make([]tclTok, 0, 16)
 	res = append(res, p.parseToken())
 	p.eatWhile(issepspace)
@@ -335,7 +367,7 @@ func (p *parser) parseCommand() command {
 		res = append(res, p.parseToken())
 		p.eatWhile(issepspace)
 	}
-	return makeCommand(res)
+	return p.makeCommand(res, line)
 }
 
 func (p *parser) parseToken() tclTok {
@@ -370,7 +402,13 @@ func parseListInner(in io.RuneReader) (items []string, err error) {
 }
 
 func parseCommands(in io.RuneReader) (cmds []command, err error) {
+	return parseCommandsAt(in, srcPos{line: 1})
+}
+
+// parseCommandsAt is parseCommands for a script starting at pos.
+func parseCommandsAt(in io.RuneReader, pos srcPos) (cmds []command, err error) {
 	p := newParser(in)
+	p.file, p.line = pos.file, pos.line
 	defer setError(&err)
 	cmds = p.parseCommands()
 	return
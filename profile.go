@@ -0,0 +1,341 @@
+package gotcl
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A ProfileEntry is what a Profiler measured of a command.
+type ProfileEntry struct {
+	Name  string
+	Proc  bool // the command was a proc when last called
+	Calls int
+	// Total is the time spent in the command and what it called, not
+	// counting recursive calls twice; Self leaves out what it called.
+	Total, Self time.Duration
+}
+
+// A profNode is a command called from the command that's its parent,
+// making a tree of the call stacks seen.
+type profNode struct {
+	name     string
+	parent   *profNode
+	children map[string]*profNode
+	calls    int
+	total    time.Duration
+	self     time.Duration
+}
+
+func (n *profNode) child(name string) *profNode {
+	c, ok := n.children[name]
+	if !ok {
+		if n.children == nil {
+			n.children = make(map[string]*profNode)
+		}
+		c = &profNode{name: name, parent: n}
+		n.children[name] = c
+	}
+	return c
+}
+
+// A Profiler measures the calls and the time spent in each command an
+// interp runs while it's profiling.
+type Profiler struct {
+	start   time.Time
+	elapsed time.Duration
+	entries map[string]*ProfileEntry
+	root    profNode
+	at      *profNode
+	// Calls of each command in progress, so recursion isn't counted
+	// twice in their totals.
+	active map[string]int
+}
+
+// StartProfile has i profile the commands it runs until StopProfile is
+// called. Scripts are interpreted rather than compiled meanwhile, so
+// that each command is seen.
+func (i *Interp) StartProfile() *Profiler {
+	if i.prof == nil {
+		p := &Profiler{start: time.Now(), entries: make(map[string]*ProfileEntry), active: make(map[string]int)}
+		p.at = &p.root
+		i.prof = p
+	}
+	return i.prof
+}
+
+// StopProfile stops the profiling StartProfile started, returning what
+// was measured, or nil if i wasn't profiling.
+func (i *Interp) StopProfile() *Profiler {
+	p := i.prof
+	if p != nil {
+		p.elapsed = time.Since(p.start)
+		i.prof = nil
+		i.profiled = p
+	}
+	return p
+}
+
+// duration returns how long profiling went on, or has so far.
+func (p *Profiler) duration() time.Duration {
+	if p.elapsed == 0 {
+		return time.Since(p.start)
+	}
+	return p.elapsed
+}
+
+// call calls the command name, measuring it.
+func (p *Profiler) call(i *Interp, name string, f TclCmd, args []*TclObj) TclStatus {
+	e, ok := p.entries[name]
+	if !ok {
+		e = &ProfileEntry{Name: name}
+		p.entries[name] = e
+	}
+	if info, ok := i.cmdinfo[name]; ok {
+		e.Proc = info.proc != nil
+	}
+	parent := p.at
+	n := parent.child(name)
+	p.at = n
+	p.active[name]++
+	start := time.Now()
+	rc := f(i, args)
+	d := time.Since(start)
+	p.active[name]--
+	p.at = parent
+	e.Calls++
+	n.calls++
+	n.total += d
+	n.self += d
+	parent.self -= d
+	if p.active[name] == 0 {
+		e.Total += d
+	}
+	return rc
+}
+
+// Entries returns what was measured of each command, those taking the
+// most time themselves first.
+func (p *Profiler) Entries() []ProfileEntry {
+	// Self times are only known per stack, as the time spent in each
+	// call less that in the calls it made.
+	self := make(map[string]time.Duration)
+	var walk func(n *profNode)
+	walk = func(n *profNode) {
+		self[n.name] += n.self
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	for _, c := range p.root.children {
+		walk(c)
+	}
+	res := make([]ProfileEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		ent := *e
+		ent.Self = self[e.Name]
+		res = append(res, ent)
+	}
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].Self != res[b].Self {
+			return res[a].Self > res[b].Self
+		}
+		return res[a].Name < res[b].Name
+	})
+	return res
+}
+
+// WriteReport writes a table of the Entries to w, then the tree of the
+// call stacks seen.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "calls\ttotal\tself\tself%%\t command\n")
+	elapsed := p.duration()
+	for _, e := range p.Entries() {
+		name := e.Name
+		if e.Proc {
+			name += " (proc)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%.1f%%\t %s\n", e.Calls, e.Total, e.Self,
+			100*float64(e.Self)/float64(elapsed), name)
+	}
+	if e := tw.Flush(); e != nil {
+		return e
+	}
+	fmt.Fprintf(w, "\ncall tree:\n")
+	var walk func(n *profNode, depth int)
+	walk = func(n *profNode, depth int) {
+		kids := make([]*profNode, 0, len(n.children))
+		for _, c := range n.children {
+			kids = append(kids, c)
+		}
+		sort.Slice(kids, func(a, b int) bool { return kids[a].total > kids[b].total })
+		for _, c := range kids {
+			_, e := fmt.Fprintf(w, "%s%s  %d calls, %s\n", strings.Repeat("  ", depth), c.name, c.calls, c.total)
+			if e != nil {
+				return
+			}
+			walk(c, depth+1)
+		}
+	}
+	walk(&p.root, 1)
+	return nil
+}
+
+// WritePprof writes the call stacks seen to w as a gzipped profile for
+// go tool pprof, with the calls and the time spent in each.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		ix, ok := strs[s]
+		if !ok {
+			ix = len(table)
+			strs[s] = ix
+			table = append(table, s)
+		}
+		return uint64(ix)
+	}
+	// Each command is one function, at one location, with the same id.
+	ids := make(map[string]uint64)
+	var funcs, samples protoBuf
+	var walk func(n *profNode, stack []uint64)
+	walk = func(n *profNode, stack []uint64) {
+		id, ok := ids[n.name]
+		if !ok {
+			id = uint64(len(ids) + 1)
+			ids[n.name] = id
+			var f protoBuf
+			f.uint(1, id)
+			f.uint(2, str(n.name))
+			f.uint(3, str(n.name))
+			funcs.bytes(5, f)
+		}
+		stack = append([]uint64{id}, stack...)
+		var s protoBuf
+		s.packed(1, stack)
+		s.packed(2, []uint64{uint64(n.calls), uint64(n.self)})
+		samples.bytes(2, s)
+		for _, c := range n.children {
+			walk(c, stack)
+		}
+	}
+	for _, c := range p.root.children {
+		walk(c, nil)
+	}
+	var prof protoBuf
+	for _, st := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuf
+		vt.uint(1, str(st[0]))
+		vt.uint(2, str(st[1]))
+		prof.bytes(1, vt)
+	}
+	prof = append(prof, samples...)
+	for id := uint64(1); id <= uint64(len(ids)); id++ {
+		var line, loc protoBuf
+		line.uint(1, id)
+		loc.uint(1, id)
+		loc.bytes(4, line)
+		prof.bytes(4, loc)
+	}
+	prof = append(prof, funcs...)
+	for _, s := range table {
+		prof.bytes(6, protoBuf(s))
+	}
+	prof.uint(9, uint64(p.start.UnixNano()))
+	prof.uint(10, uint64(p.duration()))
+	var pt protoBuf
+	pt.uint(1, str("time"))
+	pt.uint(2, str("nanoseconds"))
+	prof.bytes(11, pt)
+	zw := gzip.NewWriter(w)
+	if _, e := zw.Write(prof); e != nil {
+		return e
+	}
+	return zw.Close()
+}
+
+// protoBuf is an encoded protocol buffer message, as pprof uses.
+type protoBuf []byte
+
+func (b *protoBuf) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuf) uint(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuf) packed(field int, xs []uint64) {
+	var p protoBuf
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p)
+}
+
+// profileWrite makes a profile subcommand writing the profile taken
+// with write, to the file named, or as its result if there's no name and
+// toString is true.
+func profileWrite(cmd string, toString bool, write func(*Profiler, io.Writer) error) func(*Interp, []*TclObj) TclStatus {
+	return func(i *Interp, args []*TclObj) TclStatus {
+		p := i.prof
+		if p == nil {
+			p = i.profiled
+		}
+		switch {
+		case p == nil:
+			return i.FailStr("no profile has been taken")
+		case len(args) == 0 && toString:
+			var sb strings.Builder
+			write(p, &sb)
+			return i.Return(FromStr(sb.String()))
+		case len(args) != 1:
+			return i.FailStr("wrong # args: should be \"profile " + cmd + " fileName\"")
+		}
+		return i.writeFile(args[0].AsString(), func(w io.Writer) error { return write(p, w) })
+	}
+}
+
+// writeFile creates the file name in i's filesystem and has write
+// write it.
+func (i *Interp) writeFile(name string, write func(io.Writer) error) TclStatus {
+	f, e := i.FS().Create(name)
+	if e != nil {
+		return i.Fail(e)
+	}
+	e = write(f)
+	if ce := f.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(kNil)
+}
+
+var profileEn = ensembleSpec{
+	"start":  func(i *Interp) { i.StartProfile() },
+	"stop":   func(i *Interp) { i.StopProfile() },
+	"report": profileWrite("report", true, (*Profiler).WriteReport),
+	"pprof":  profileWrite("pprof", false, (*Profiler).WritePprof),
+}
+
+func init() {
+	RegisterDefaultCmd("profile", profileEn.makeCmd())
+}
@@ -0,0 +1,57 @@
+package gotcl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	i := NewInterp()
+	_, e := i.EvalString(`
+proc fib {n} {
+	if {$n < 2} { return $n }
+	expr {[fib [expr {$n - 1}]] + [fib [expr {$n - 2}]]}
+}
+profile start
+fib 10
+profile stop
+fib 5`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	calls := make(map[string]int)
+	for _, e := range i.profiled.Entries() {
+		calls[e.Name] = e.Calls
+		if e.Name == "fib" && (!e.Proc || e.Self > e.Total) {
+			t.Errorf("fib: got %+v", e)
+		}
+	}
+	if calls["fib"] != 177 || calls["profile"] != 1 {
+		t.Errorf("got calls %v", calls)
+	}
+	v, e := i.EvalString("profile report")
+	if e != nil || !strings.Contains(v.AsString(), " fib (proc)\n") ||
+		!strings.Contains(v.AsString(), "\n  fib  1 calls") ||
+		!strings.Contains(v.AsString(), "\n      fib  2 calls") {
+		t.Errorf("report: got %v, %v", v, e)
+	}
+
+	var buf bytes.Buffer
+	if e := i.profiled.WritePprof(&buf); e != nil {
+		t.Fatal(e)
+	}
+	zr, e := gzip.NewReader(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := io.ReadAll(zr)
+	if e != nil || !bytes.Contains(data, []byte("nanoseconds")) || !bytes.Contains(data, []byte("fib")) {
+		t.Errorf("pprof: got %q, %v", data, e)
+	}
+	if _, e := NewSafeInterp().EvalString("profile start"); e == nil {
+		t.Error("profile available in a safe interp")
+	}
+}
@@ -0,0 +1,197 @@
+package gotcl
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Snapshot is the state scripts have built up in an interp: its procs
+// and global variables. Commands defined in Go can't be saved, so only
+// their names are recorded, and they must be defined again in an
+// interp before the snapshot can be restored into it. The interpreter
+// has no namespaces, so there's nothing more to save.
+type Snapshot struct {
+	Procs    []ProcSnapshot
+	Vars     []VarSnapshot
+	Commands []string
+	Renames  []RenameSnapshot
+}
+
+type ProcSnapshot struct {
+	Name, Args, Body string
+}
+
+// A RenameSnapshot records that a command defined in Go was renamed
+// from From to To.
+type RenameSnapshot struct {
+	From, To string
+}
+
+type VarSnapshot struct {
+	Name     string
+	Value    string
+	IsArray  bool
+	Elements map[string]string
+}
+
+// Snapshot returns the current state of i.
+func (i *Interp) Snapshot() *Snapshot {
+	s := new(Snapshot)
+	for name := range i.cmds {
+		ci := i.cmdinfo[name]
+		if ci != nil && ci.proc != nil {
+			s.Procs = append(s.Procs,
+				ProcSnapshot{name, ci.proc.args.AsString(), ci.proc.body.AsString()})
+		} else if ci != nil && ci.origin != "" {
+			s.Renames = append(s.Renames, RenameSnapshot{ci.origin, name})
+		} else if _, ok := tclBasicCmds[name]; !ok && name != "proc" && name != "error" {
+			s.Commands = append(s.Commands, name)
+		}
+	}
+	g := i.varFrame(true)
+	for _, name := range g.names() {
+		v := g.lookup(name)
+		switch {
+		case v.arrdata != nil:
+			elts := make(map[string]string, len(v.arrdata))
+			for k, e := range v.arrdata {
+				elts[k] = e.AsString()
+			}
+			s.Vars = append(s.Vars, VarSnapshot{Name: name, IsArray: true, Elements: elts})
+		case v.obj != nil:
+			s.Vars = append(s.Vars, VarSnapshot{Name: name, Value: v.obj.AsString()})
+		}
+	}
+	sort.Slice(s.Procs, func(a, b int) bool { return s.Procs[a].Name < s.Procs[b].Name })
+	sort.Slice(s.Vars, func(a, b int) bool { return s.Vars[a].Name < s.Vars[b].Name })
+	sort.Strings(s.Commands)
+	sort.Slice(s.Renames, func(a, b int) bool { return s.Renames[a].To < s.Renames[b].To })
+	return s
+}
+
+// needs returns the names of the Go commands s needs, which are
+// renamed as well as recorded ones.
+func (s *Snapshot) needs() []string {
+	names := append([]string(nil), s.Commands...)
+	for _, r := range s.Renames {
+		names = append(names, r.From)
+	}
+	return names
+}
+
+// Restore renames the commands, and defines the procs and global
+// variables, saved in s in i. It fails without changing anything if i
+// lacks any of the Go commands s needs, or a proc's arguments aren't a
+// list.
+func (i *Interp) Restore(s *Snapshot) error {
+	var missing []string
+	for _, name := range s.needs() {
+		if _, ok := i.cmds[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		return errors.New("snapshot needs missing commands: " + strings.Join(missing, ", "))
+	}
+	for _, p := range s.Procs {
+		if _, e := FromStr(p.Args).AsList(); e != nil {
+			return fmt.Errorf("proc %s: %v", p.Name, e)
+		}
+	}
+	// Renames go by way of temporary names, in case one command takes
+	// the name another gives up.
+	for ix, r := range s.Renames {
+		i.renameCmd(r.From, renameTemp(ix))
+	}
+	for ix, r := range s.Renames {
+		i.renameCmd(renameTemp(ix), r.To)
+	}
+	for _, p := range s.Procs {
+		if _, e := i.Call("proc", FromStr(p.Name), FromStr(p.Args), FromStr(p.Body)); e != nil {
+			return e
+		}
+	}
+	g := i.varFrame(true)
+	for _, v := range s.Vars {
+		if !v.IsArray {
+			*g.create(v.Name) = varEntry{obj: FromStr(v.Value)}
+			continue
+		}
+		arr := make(map[string]*TclObj, len(v.Elements))
+		for k, e := range v.Elements {
+			arr[k] = FromStr(e)
+		}
+		*g.create(v.Name) = varEntry{arrdata: arr}
+	}
+	return nil
+}
+
+// renameTemp returns the temporary name for the ix'th rename.
+func renameTemp(ix int) string {
+	return fmt.Sprintf("snapshot rename %d", ix)
+}
+
+// globPattern returns a glob pattern matching just s.
+func globPattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune("*?[]\\", c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// WriteScript writes s as a script that restores it when evaluated.
+func (s *Snapshot) WriteScript(w io.Writer) error {
+	var b strings.Builder
+	for _, name := range s.needs() {
+		fmt.Fprintf(&b, "if {[llength [info commands %s]] == 0} {error %s}\n",
+			quoteElem(globPattern(name)), quoteElem("snapshot needs missing command \""+name+"\""))
+	}
+	for ix, r := range s.Renames {
+		fmt.Fprintf(&b, "rename %s %s\n", quoteElem(r.From), quoteElem(renameTemp(ix)))
+	}
+	for ix, r := range s.Renames {
+		fmt.Fprintf(&b, "rename %s %s\n", quoteElem(renameTemp(ix)), quoteElem(r.To))
+	}
+	for _, p := range s.Procs {
+		fmt.Fprintf(&b, "proc %s %s %s\n", quoteElem(p.Name), quoteElem(p.Args), quoteElem(p.Body))
+	}
+	for _, v := range s.Vars {
+		if !v.IsArray {
+			fmt.Fprintf(&b, "set %s %s\n", quoteElem("::"+v.Name), quoteElem(v.Value))
+			continue
+		}
+		keys := make([]string, 0, len(v.Elements))
+		for k := range v.Elements {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var elts []string
+		for _, k := range keys {
+			elts = append(elts, quoteElem(k), quoteElem(v.Elements[k]))
+		}
+		fmt.Fprintf(&b, "array set %s %s\n", quoteElem("::"+v.Name), quoteElem(strings.Join(elts, " ")))
+	}
+	_, e := io.WriteString(w, b.String())
+	return e
+}
+
+// Encode writes s in a binary form that ReadSnapshot reads back.
+func (s *Snapshot) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(s)
+}
+
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := new(Snapshot)
+	if e := gob.NewDecoder(r).Decode(s); e != nil {
+		return nil, e
+	}
+	return s, nil
+}
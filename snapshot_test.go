@@ -0,0 +1,109 @@
+package gotcl
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const snapshotSetup = `
+proc greet {who {greeting "hi there"}} {
+    if {$who == ""} { error "no one to greet" }
+    return "$greeting, $who\n"
+}
+proc odd {} { return "\{" }
+set plain value
+set spaced {a b c}
+set brace "a \{ b"
+set special {$x [y] "z"}
+set empty {}
+array set arr {k1 v1 {k 2} {v 2}}
+array set none {}
+rename puts _puts
+rename gocmd puts
+`
+
+func snapshotInterp() *Interp {
+	i := NewInterp()
+	i.SetCmd("gocmd", func(i *Interp, args []*TclObj) TclStatus { return i.Return(FromStr("go")) })
+	return i
+}
+
+func TestSnapshotScript(t *testing.T) {
+	i := snapshotInterp()
+	RunString(i, snapshotSetup)
+	snap := i.Snapshot()
+	if !reflect.DeepEqual(snap.Commands, []string(nil)) {
+		t.Fatalf("commands: %v", snap.Commands)
+	}
+	if want := []RenameSnapshot{{"puts", "_puts"}, {"gocmd", "puts"}}; !reflect.DeepEqual(snap.Renames, want) {
+		t.Fatalf("renames: %v", snap.Renames)
+	}
+	var script bytes.Buffer
+	if e := snap.WriteScript(&script); e != nil {
+		t.Fatal(e)
+	}
+
+	j := snapshotInterp()
+	if _, e := j.EvalString(script.String()); e != nil {
+		t.Fatalf("%v in\n%s", e, script.String())
+	}
+	if got := j.Snapshot(); !reflect.DeepEqual(got, snap) {
+		t.Fatalf("got %+v, want %+v", got, snap)
+	}
+	if v, e := j.Call("greet", FromStr("you")); e != nil || v.AsString() != "hi there, you\n" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if _, e := NewInterp().EvalString(script.String()); e == nil {
+		t.Fatal("restored without gocmd")
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	i := snapshotInterp()
+	RunString(i, snapshotSetup)
+	snap := i.Snapshot()
+	var buf bytes.Buffer
+	if e := snap.Encode(&buf); e != nil {
+		t.Fatal(e)
+	}
+	read, e := ReadSnapshot(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	j := snapshotInterp()
+	if e := j.Restore(read); e != nil {
+		t.Fatal(e)
+	}
+	if got := j.Snapshot(); !reflect.DeepEqual(got, snap) {
+		t.Fatalf("got %+v, want %+v", got, snap)
+	}
+	if v, e := j.EvalString("array size none"); e != nil || v.AsString() != "0" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+	if e := NewInterp().Restore(read); e == nil {
+		t.Fatal("restored without gocmd")
+	}
+}
+
+func TestSnapshotRestoreOver(t *testing.T) {
+	i := snapshotInterp()
+	RunString(i, snapshotSetup)
+	snap := i.Snapshot()
+	j := snapshotInterp()
+	RunString(j, "array set plain {k v}")
+	bad := *snap
+	bad.Procs = append([]ProcSnapshot{{"aaa", "{", ""}}, snap.Procs...)
+	if e := j.Restore(&bad); e == nil {
+		t.Fatal("restored a proc with bad arguments")
+	}
+	if v, e := j.EvalString("list [array size plain] [info commands greet]"); e != nil || v.AsString() != "1 {}" {
+		t.Fatalf("changed by a failed restore: %v, %v", v, e)
+	}
+	if e := j.Restore(snap); e != nil {
+		t.Fatal(e)
+	}
+	if v, e := j.EvalString("list $plain [array exists plain] [puts] [llength [info commands gocmd]]"); e != nil || v.AsString() != "value 0 go 0" {
+		t.Fatalf("got %v, %v", v, e)
+	}
+}
@@ -200,6 +200,18 @@ test {list with empties} {
     assert $x == {{} {} {}}
 }
 
+test {list round trip} {
+    set slash "a\\"
+    set brace "\{"
+    set l [list $slash {$b} {[c]} $brace {x y}]
+    assert [llength "$l"] == 5
+    assert [expr {[lindex "$l" 0] == $slash}] == 1
+    assert [lindex "$l" 1] == {$b}
+    assert [lindex "$l" 2] == {[c]}
+    assert [expr {[lindex "$l" 3] == $brace}] == 1
+    assert [lindex "$l" 4] == {x y}
+}
+
 test {lappend} {
     lappend x 0
     lappend x 1 2 3 4 5
@@ -215,6 +227,267 @@ test {lappend more} {
     assert $y != $z
 }
 
+test {list ranges} {
+    set x [list a b c d e]
+    assert [lrange $x 1 end-1] == {b c d}
+    assert [lrange $x -5 1] == {a b}
+    assert [lrange $x 3 1] == {}
+    assert [lrange $x end-1 end] == {d e}
+    assert [lreplace $x 1 2 X] == {a X d e}
+    assert [lreplace $x 1 0 X Y] == {a X Y b c d e}
+    assert [lreplace $x end end] == {a b c d}
+    assert [linsert $x end f] == {a b c d e f}
+    assert [linsert $x end-1 f] == {a b c d f e}
+    assert [linsert $x 0+1 f] == {a f b c d e}
+    assert [lreverse $x] == {e d c b a}
+    assert [lrepeat 2 a b] == {a b a b}
+    assert [lrepeat 4611686018427387904] == {}
+    assert [lremove $x 0 end 0] == {b c d}
+    assert [join $x ,] == {a,b,c,d,e}
+    assert $x == {a b c d e}
+    assert_err { lrange $x 0 bogus }
+}
+
+test {list vars} {
+    set x {a {b c} d}
+    assert [lset x 1 0 B] == {a {B c} d}
+    assert [lset x {1 end} C] == {a {B C} d}
+    assert [lset x end+1 e] == {a {B C} d e}
+    assert_err { lset x 9 z }
+    assert [lpop x] == e
+    assert [lpop x 1 0] == B
+    assert $x == {a C d}
+    assert [ledit x 1 1 c1 c2] == {a c1 c2 d}
+    assert [lassign $x p q] == {c2 d}
+    assert "$p $q" == {a c1}
+    assert [lassign {1} p q] == {}
+    assert $q == {}
+    set y {a b}
+    assert [lset y {} c] == c
+    assert $y == c
+}
+
+test {lsort} {
+    assert [lsort {b A a B}] == {A B a b}
+    assert [lsort {}] == {}
+    assert [lsort -index] == {-index}
+    assert [lsort -nocase {b A a B}] == {A a b B}
+    assert [lsort -decreasing {a c b}] == {c b a}
+    assert [lsort -integer {10 9 -1 100}] == {-1 9 10 100}
+    assert [lsort -real {1.5 1e0 -2}] == {-2 1e0 1.5}
+    assert [lsort -dictionary {x10 x9 X9 x09 b}] == {b X9 x9 x09 x10}
+    assert [lsort -unique {c a b a c}] == {a b c}
+    assert [lsort -indices {c a b}] == {1 2 0}
+    assert [lsort -index 1 -integer {{a 3} {b 1} {c 2}}] == {{b 1} {c 2} {a 3}}
+    assert [lsort -index {1 0} {{a {z 1}} {b {y 2}}}] == {{b {y 2}} {a {z 1}}}
+    assert [lsort -stride 2 -index 1 -integer {a 3 b 1 c 2}] == {b 1 c 2 a 3}
+    assert [lsort -stride 2 {b 1 a 2}] == {a 2 b 1}
+    proc bylen {a b} { expr {[string length $a] - [string length $b]} }
+    assert [lsort -command bylen {ccc a bb b}] == {a b bb ccc}
+    assert [lsort -index 0 {{b 1} {a 1} {b 0} {a 2}}] == {{a 1} {a 2} {b 1} {b 0}}
+    assert_err { lsort -integer {1 x} }
+    assert_err { lsort -stride 2 {a b c} }
+}
+
+test {lsearch options} {
+    set x {apple Banana cherry banana date}
+    assert [lsearch $x b*] == 3
+    assert [lsearch -nocase $x b*] == 1
+    assert [lsearch -all -nocase $x B*] == {1 3}
+    assert [lsearch -exact $x b*] == -1
+    assert [lsearch -regexp $x {^.a}] == 1
+    assert [lsearch -all -not $x *a*] == {2}
+    assert [lsearch -inline $x c*] == cherry
+    assert [lsearch -inline $x z*] == {}
+    assert [lsearch -all -inline -glob $x *an*] == {Banana banana}
+    assert [lsearch -start 2 $x *an*] == 3
+    assert [lsearch -start end $x *an*] == -1
+    assert [lsearch -index 1 {{a 1} {b 2}} 2] == 1
+    assert [lsearch -index 1 -inline {{a 1} {b 2}} 2] == {b 2}
+    assert [lsearch -exact -integer {1 01 2} 1] == 0
+    assert [lsearch -exact -integer -all {1 01 2} 1] == {0 1}
+    assert [lsearch -exact -real {1.5 2} 2.0] == 1
+    assert [lsearch -sorted {a b c d e} d] == 3
+    assert [lsearch -sorted {a b c d e} bb] == -1
+    assert [lsearch -sorted -integer {1 3 3 3 9} 3] == 1
+    assert [lsearch -sorted -integer -all {1 3 3 3 9} 3] == {1 2 3}
+    assert [lsearch -sorted -decreasing -integer {9 5 2 1} 2] == 2
+    assert [lsearch -sorted -glob {apple banana cherry} b*] == 1
+    assert [lsearch -sorted -all -regexp {ab bc cd} {[bc]}] == {0 1 2}
+    assert_err { lsearch -regexp $x {(} }
+}
+
+test {foreach lists} {
+    set r {}
+    foreach {a b} {1 2 3} c {x y z w} {
+        lappend r "$a:$b:$c"
+    }
+    assert $r == {1:2:x 3::y ::z ::w}
+    proc pairs {l1 l2} {
+        set r {}
+        foreach a $l1 {b c} $l2 {
+            lappend r "$a:$b:$c"
+        }
+        return $r
+    }
+    assert [pairs {1 2} {x y z}] == {1:x:y 2:z:}
+    assert_err { foreach a {1} b }
+    assert_err { foreach {} {1} {} }
+}
+
+test {lmap} {
+    assert [lmap x {1 2 3} { expr {$x * 2} }] == {2 4 6}
+    assert [lmap {a b} {1 2 3 4} c {x y} { list "$a-$c" $b }] == {{1-x 2} {3-y 4}}
+    assert [lmap x {1 2 3 4 5} {
+        if {$x == 2} continue
+        if {$x == 4} break
+        set x
+    }] == {1 3}
+    proc big {l} { lmap x $l { if {$x < 3} continue; set x } }
+    assert [big {1 2 3 4}] == {3 4}
+}
+
+test {dict basics} {
+    set d [dict create b 2 a 1]
+    assert $d == {b 2 a 1}
+    assert [dict get $d a] == 1
+    assert [dict size $d] == 2
+    assert [dict keys $d] == {b a}
+    assert [dict values $d] == {2 1}
+    assert [dict keys {ab 1 ac 2 b 3} a*] == {ab ac}
+    assert [dict exists $d a] == 1
+    assert [dict exists $d z] == 0
+    assert [dict get {a {b {c 3}}} a b c] == 3
+    assert [dict get [dict create a {1 2}] a] == {1 2}
+    assert [dict exists {a {b {c 3}}} a b x] == 0
+    assert [dict create a 1 a 2] == {a 2}
+    assert [dict merge {a 1 b 2} {b 3 c 4}] == {a 1 b 3 c 4}
+    assert [dict remove {a 1 b 2 c 3} b x] == {a 1 c 3}
+    assert [dict replace {a 1 b 2} b 5 c 6] == {a 1 b 5 c 6}
+}
+
+test {dict variables} {
+    dict set d x 1
+    dict set d y z 2
+    assert $d == {x 1 y {z 2}}
+    dict set d y w 3
+    assert [dict get $d y] == {z 2 w 3}
+    dict unset d y z
+    assert $d == {x 1 y {w 3}}
+    dict unset d nosuch
+    dict append d s a b
+    dict append d s c
+    dict lappend d l a {b c}
+    dict incr d n
+    dict incr d n 5
+    dict incr d x -1
+    assert $d == {x 0 y {w 3} s abc l {a {b c}} n 6}
+    dict incr counts a
+    dict lappend words a x
+    assert "$counts $words" == {a 1 a x}
+    assert_err { dict with nosuch {} }
+    dict unset fresh a
+    assert [info exists fresh] == 1
+    assert [dict size $fresh] == 0
+    set a [dict create k 1]
+    set b $a
+    dict set a j 2
+    dict set b j 3
+    dict set a k 5
+    dict unset a k
+    dict set a k 6
+    assert "$b | $a" == {k 1 j 3 | j 2 k 6}
+}
+
+test {dict loops} {
+    set r {}
+    dict for {k v} {a 1 b 2 c 3 d 4} {
+        if {$k == "b"} continue
+        if {$k == "d"} break
+        lappend r "$k=$v"
+    }
+    assert $r == {a=1 c=3}
+    assert [dict map {k v} {a 1 b 2} { expr {$v * 10} }] == {a 10 b 20}
+    assert [dict filter {a 1 b 2 ab 3} key a*] == {a 1 ab 3}
+    assert [dict filter {a 1 b 2 c 1} value 1] == {a 1 c 1}
+    assert [dict filter {a 1 b 2 c 3} script {k v} { expr {$v > 1} }] == {b 2 c 3}
+}
+
+test {dict with and update} {
+    set d {a 1 b 2}
+    dict with d {
+        incr a
+        set c 3
+        unset b
+    }
+    assert $d == {a 2}
+    set n {in {x 1}}
+    dict with n in { set x 5 }
+    assert $n == {in {x 5}}
+    set d {a 1 b 2}
+    dict update d a p z q {
+        set p 10
+        set q new
+    }
+    assert $d == {a 10 b 2 z new}
+    catch { dict update d a p { set p 20; error oops } }
+    assert [dict get $d a] == 20
+}
+
+test {dict string form} {
+    set odd "q\"\}"
+    set d [dict create {a b} {c d} x {} y $odd]
+    assert [dict get $d {a b}] == {c d}
+    assert [dict get $d x] == {}
+    assert [expr {[dict get [string trim " $d "] y] == $odd}] == 1
+}
+
+test {file names} {
+    assert [file join a b/c] == a/b/c
+    assert [file join a /b c/] == /b/c
+    assert [file split /a/b//c] == {/ a b c}
+    assert [file dirname /a/b] == /a
+    assert [file dirname /a] == /
+    assert [file dirname a] == .
+    assert [file tail /a/b.tcl] == b.tcl
+    assert [file extension /a/b.c.tcl] == .tcl
+    assert [file extension /a.b/.c] == {}
+    assert [file rootname a/b.tcl] == a/b
+}
+
+test {package versions} {
+    assert [package vcompare 1.2 1.10] == -1
+    assert [package vcompare 2 1.10] == 1
+    assert [package vcompare 1.0 1.0] == 0
+    assert [package vcompare 1 1.0] == -1
+    assert [package vsatisfies 1.3 1.2] == 1
+    assert [package vsatisfies 2.0 1.2] == 0
+    assert [package vsatisfies 1.1 1.2] == 0
+    assert [package vsatisfies 2.0 1.2-] == 1
+    assert [package vsatisfies 2.0 1.2-2.0] == 0
+    assert [package vsatisfies 1.9.9 1.2-2.0] == 1
+    assert [package vsatisfies 3.1 1.2 3] == 1
+}
+
+test {package require} {
+    package ifneeded tpkg 1.0 {package provide tpkg 1.0; set ::tpkg_loaded 1.0}
+    package ifneeded tpkg 1.5 {package provide tpkg 1.5; set ::tpkg_loaded 1.5}
+    package ifneeded tpkg 2.1 {package provide tpkg 2.1; set ::tpkg_loaded 2.1}
+    assert [package versions tpkg] == {1.0 1.5 2.1}
+    assert [package require tpkg 1.2] == 1.5
+    assert $::tpkg_loaded == 1.5
+    assert [package provide tpkg] == 1.5
+    assert [package present tpkg 1] == 1.5
+    assert [lsearch [package names] tpkg] >= 0
+    package forget tpkg
+    assert [package versions tpkg] == {}
+    assert [package provide tpkg] == {}
+    package ifneeded tpkg 1.0 {package provide tpkg 1.0}
+    package ifneeded tpkg 1.1 {package provide tpkg 1.1}
+    assert [package require -exact tpkg 1.0] == 1.0
+    package forget tpkg
+}
+
 test {args} {
     proc count_args {args} {
         return [llength $args]
@@ -222,6 +495,23 @@ test {args} {
     assert [count_args 1 2 3] == 3
 }
 
+test {proc arity} {
+    proc two {a b} { return $b }
+    assert [catch { two 1 2 3 } msg] == 1
+    assert $msg == {wrong # args: should be "two a b"}
+    assert [catch { two 1 } msg] == 1
+    proc opt {a {b 2} args} { return [llength $args] }
+    assert [opt 1] == 0
+    assert [opt 1 2 3 4] == 2
+    assert [catch { opt } msg] == 1
+    assert $msg == {wrong # args: should be "opt a ?b? ?arg ...?"}
+    assert [catch { apply {{x y} { return $x }} 1 } msg] == 1
+    assert $msg == {wrong # args: should be "apply lambdaExpr x y"}
+    rename two three
+    assert [catch { three 1 } msg] == 1
+    assert $msg == {wrong # args: should be "three a b"}
+}
+
 test {bad proc} {
     proc fizzle {x} { " }
     set ec [catch { fizzle 4 } msg]
@@ -356,6 +646,27 @@ test {string index} {
     assert [string index "" 4] == ""
     assert [string index "abcdefg" 0] == "a"
     assert [string index "abcdefg" 2] == "c"
+    assert [string index "abcdefg" end-1] == "f"
+    assert [string index "abcdefg" 1+1] == "c"
+    assert [string index "abcdefg" -1] == ""
+    assert [string index "abcdefg" end+1] == ""
+    assert [string index "héllo" 1] == "é"
+    assert_err { string index "abc" bogus }
+}
+
+test {lindex indices} {
+    set x {a {b {c d}} e}
+    assert [lindex $x end] == e
+    assert [lindex $x end-2] == a
+    assert [lindex $x 0+2] == e
+    assert [lindex $x 3] == ""
+    assert [lindex $x -1] == ""
+    assert [lindex $x 1 1 end] == d
+    assert [lindex $x {1 0}] == b
+    assert [lindex $x] == $x
+    assert [lindex $x {}] == $x
+    assert_err { lindex $x end- }
+    assert_err { lindex $x 1.5 }
 }
 
 test {string trim} {
@@ -569,6 +880,161 @@ test { list parsing again } {
 }
 
 
+test {interp eval} {
+    set c [interp create]
+    interp eval $c { set x 5 }
+    assert [interp eval $c { incr x }] == 6
+    assert [$c eval {set x}] == 6
+    assert [info exists x] == 0
+    interp delete $c
+    assert [interp exists $c] == 0
+}
+
+test {interp alias} {
+    interp create ali
+    proc double {x} { return [+ $x $x] }
+    interp alias ali twice {} double
+    assert [ali eval { twice 4 }] == 8
+    assert [interp alias ali twice] == double
+    ali alias plus10 + 10
+    assert [ali eval { plus10 1 }] == 11
+    interp alias ali twice {}
+    assert_err { ali eval { twice 4 } }
+    interp delete ali
+}
+
+test {interp hide expose} {
+    interp create hid
+    hid hide puts
+    assert_err { hid eval { puts foo } }
+    assert [interp hidden hid] == puts
+    hid expose puts say
+    assert [llength [hid eval { info commands say }]] == 1
+    interp delete hid
+}
+
+test {safe interp} {
+    set s [interp create -safe]
+    assert [interp issafe $s] == 1
+    assert [interp issafe] == 0
+    assert_err { interp eval $s { open test.tcl } }
+    assert_err { interp eval $s { source test.tcl } }
+    assert_err { interp eval $s { puts hi } }
+    interp share {} stdout $s
+    assert_noerr { interp eval $s { flush stdout } }
+    assert [lsearch [interp hidden $s] open] > -1
+    assert_err { interp eval $s { interp invokehidden {} exit } }
+    set inner [interp eval $s { interp create }]
+    assert [interp issafe [list $s $inner]] == 1
+    assert_err { interp eval $s { interp create c; interp expose c open } }
+    assert_err { interp eval $s { interp create d; interp invokehidden d open test.tcl } }
+    assert_err { interp eval $s { interp limit {} commands -value 5 } }
+    interp delete $s
+}
+
+test {interp limit} {
+    interp create lim
+    lim limit commands -value [+ [lim eval {info cmdcount}] 100]
+    assert_err { lim eval { while 1 { set x 1 } } }
+    assert_err { lim eval { set x 2 } }
+    lim limit commands -value {}
+    assert [lim eval { set x 3 }] == 3
+    lim limit commands -value [+ [lim eval {info cmdcount}] 100]
+    assert_err { lim eval { interp limit {} commands -value {} } }
+    assert [lindex [lim limit commands] 1] != {}
+    interp delete lim
+}
+
+test {if elseif} {
+    proc classify n {
+        if {$n < 0} then {
+            return neg
+        } elseif {$n == 0} {
+            return zero
+        } elseif {$n < 10} {
+            return small
+        } else {
+            return big
+        }
+    }
+    assert [classify -1] == neg
+    assert [classify 0] == zero
+    assert [classify 5] == small
+    assert [classify 50] == big
+    assert [if 0 {set x 1}] == {}
+}
+
+test {compiled loops} {
+    proc loops {} {
+        set r {}
+        for {set i 0} {$i < 10} {incr i} {
+            if {$i == 2} { continue }
+            if {$i == 6} { break }
+            foreach {a b} {x y z} {
+                if {$a == "z"} { break }
+                set r "$r$i$a$b"
+            }
+        }
+        set n 0
+        while {[incr n] < 100} {
+            if {[catch { break } code] == 3} { set r "$r!" }
+            if {$n >= 2} break
+        }
+        return "$r $n"
+    }
+    assert [loops] == "0xy1xy3xy4xy5xy!! 2"
+}
+
+test {compiled expr} {
+    proc logic {a} {
+        set n 0
+        set x [expr {$a && [incr n]}]
+        set y [expr {$a || [incr n]}]
+        return "$x $y $n [expr {$a ? "yes" : "no"}] [expr {!$a}] [expr {($a ? $n : $a) + $n}]"
+    }
+    assert [logic 0] == "0 1 1 no 1 1"
+    assert [logic 5] == "1 1 1 yes 0 2"
+}
+
+test {compiled vars} {
+    set ::gv 1
+    proc vars {a {b 2} args} {
+        upvar c cc
+        set cc [+ $a $b]
+        incr ::gv
+        set arr(k) $args
+        set local 1
+        return [info vars]
+    }
+    proc caller {} {
+        set v [vars 1]
+        return "$c $v"
+    }
+    assert [caller] == "3 a b args cc local arr"
+    assert $::gv == 2
+    proc unset_incr {} {
+        set x 1
+        unset x
+        incr x
+    }
+    assert_err { unset_incr }
+}
+
+test {redefined builtin} {
+    interp create c
+    c eval {
+        proc count {} {
+            set n 0
+            for {set i 0} {$i < 3} {incr i} { incr n 2 }
+            return $n
+        }
+        rename incr _incr
+        proc incr {v {by 1}} { upvar $v x; set x [expr {$x + $by * 10}] }
+    }
+    assert [c eval count] == 20
+    interp delete c
+}
+
 proc fib {n} {
     if { $n < 2 } {
         return 1
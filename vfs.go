@@ -0,0 +1,303 @@
+package gotcl
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A VFS is a filesystem for an interp's scripts. Every command that
+// touches files, such as source, open, glob and file, goes through the
+// interp's VFS, so scripts can be read from wherever the program keeps
+// them. Names are as scripts give them: slash-separated, and absolute
+// or relative.
+type VFS interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries of the directory name, sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// A WritableVFS is a VFS in which files can be created.
+type WritableVFS interface {
+	VFS
+	Create(name string) (io.WriteCloser, error)
+}
+
+// OSFS is the host's filesystem, which interps use unless given
+// another with SetVFS.
+var OSFS WritableVFS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
+// FromFS returns fsys, such as an embed.FS, as a VFS. Names are taken
+// relative to its root, whether or not they start with a slash.
+func FromFS(fsys fs.FS) VFS {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) name(n string) string {
+	if n = path.Clean("/" + n)[1:]; n == "" {
+		return "."
+	}
+	return n
+}
+
+func (f ioFS) Open(name string) (fs.File, error)     { return f.fsys.Open(f.name(name)) }
+func (f ioFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(f.fsys, f.name(name)) }
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, f.name(name))
+}
+
+// ZipFS returns the contents of the zip archive in r, which is size
+// bytes long, as a read-only VFS.
+func ZipFS(r io.ReaderAt, size int64) (VFS, error) {
+	zr, e := zip.NewReader(r, size)
+	if e != nil {
+		return nil, e
+	}
+	return FromFS(zr), nil
+}
+
+// zipfsRoot is where zipfs mount puts archives mounted at relative
+// paths.
+const zipfsRoot = "//zipfs:/"
+
+type mount struct {
+	point string
+	fs    VFS
+	from  string // the archive, for zipfs mount
+}
+
+// A vfsTable is an interp's base filesystem with others mounted over
+// it. It isn't changed once made, so interps can share it.
+type vfsTable struct {
+	base   VFS
+	mounts []mount
+}
+
+// cleanName cleans n for comparing with mount points, keeping a
+// leading double slash.
+func cleanName(n string) string {
+	if strings.HasPrefix(n, "//") {
+		return "/" + path.Clean(n[1:])
+	}
+	return path.Clean(n)
+}
+
+// under returns name relative to the mount point, if it's at or below
+// it.
+func (m *mount) under(name string) (string, bool) {
+	switch {
+	case name == m.point:
+		return ".", true
+	case m.point == "/" && strings.HasPrefix(name, "/"):
+		return name[1:], true
+	case strings.HasPrefix(name, m.point+"/"):
+		return name[len(m.point)+1:], true
+	}
+	return "", false
+}
+
+// each calls fn with each filesystem name might be in, and its name
+// there, latest mount first, until fn returns true.
+func (t *vfsTable) each(name string, fn func(VFS, string) bool) {
+	cn := cleanName(name)
+	for ix := len(t.mounts) - 1; ix >= 0; ix-- {
+		if rel, ok := t.mounts[ix].under(cn); ok && fn(t.mounts[ix].fs, rel) {
+			return
+		}
+	}
+	fn(t.base, name)
+}
+
+func (t *vfsTable) Open(name string) (f fs.File, e error) {
+	t.each(name, func(v VFS, n string) bool {
+		f, e = v.Open(n)
+		return !errors.Is(e, fs.ErrNotExist)
+	})
+	return
+}
+
+func (t *vfsTable) Stat(name string) (fi fs.FileInfo, e error) {
+	t.each(name, func(v VFS, n string) bool {
+		fi, e = v.Stat(n)
+		return !errors.Is(e, fs.ErrNotExist)
+	})
+	return
+}
+
+// ReadDir merges the entries of name in each filesystem it's in, the
+// latest mounted taking precedence.
+func (t *vfsTable) ReadDir(name string) ([]fs.DirEntry, error) {
+	var ents []fs.DirEntry
+	var err error
+	seen := make(map[string]bool)
+	found := false
+	t.each(name, func(v VFS, n string) bool {
+		es, e := v.ReadDir(n)
+		if e != nil {
+			if !errors.Is(e, fs.ErrNotExist) && !found {
+				err = e
+			}
+			return false
+		}
+		found = true
+		for _, ent := range es {
+			if !seen[ent.Name()] {
+				seen[ent.Name()] = true
+				ents = append(ents, ent)
+			}
+		}
+		return false
+	})
+	if !found {
+		if err == nil {
+			err = &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	sort.Slice(ents, func(a, b int) bool { return ents[a].Name() < ents[b].Name() })
+	return ents, nil
+}
+
+// Create makes a file in the base filesystem, if it's writable and
+// name isn't under a mount point.
+func (t *vfsTable) Create(name string) (io.WriteCloser, error) {
+	cn := cleanName(name)
+	for ix := range t.mounts {
+		if _, ok := t.mounts[ix].under(cn); ok {
+			return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("read-only file system")}
+		}
+	}
+	if w, ok := t.base.(WritableVFS); ok {
+		return w.Create(name)
+	}
+	return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("read-only file system")}
+}
+
+var osTable = &vfsTable{base: OSFS}
+
+func (i *Interp) table() *vfsTable {
+	if i.vfs == nil {
+		return osTable
+	}
+	return i.vfs
+}
+
+// FS returns the filesystem i's scripts see, mounts and all.
+func (i *Interp) FS() WritableVFS {
+	return i.table()
+}
+
+// SetVFS makes v the filesystem i's scripts see outside any mounts.
+func (i *Interp) SetVFS(v VFS) {
+	t := i.table()
+	i.vfs = &vfsTable{base: v, mounts: t.mounts}
+}
+
+// Mount layers v over i's filesystem at point: names at or below it
+// are looked for in v, then in whatever was there before.
+func (i *Interp) Mount(point string, v VFS) {
+	i.mount(mount{point: cleanName(point), fs: v})
+}
+
+func (i *Interp) mount(m mount) {
+	t := i.table()
+	mounts := append(t.mounts[:len(t.mounts):len(t.mounts)], m)
+	i.vfs = &vfsTable{base: t.base, mounts: mounts}
+}
+
+// Unmount removes the filesystem last mounted at point.
+func (i *Interp) Unmount(point string) error {
+	t := i.table()
+	point = cleanName(point)
+	for ix := len(t.mounts) - 1; ix >= 0; ix-- {
+		if t.mounts[ix].point == point {
+			mounts := append(append([]mount(nil), t.mounts[:ix]...), t.mounts[ix+1:]...)
+			i.vfs = &vfsTable{base: t.base, mounts: mounts}
+			return nil
+		}
+	}
+	return errors.New("no filesystem mounted at \"" + point + "\"")
+}
+
+func tclZipfsMount(i *Interp, args []*TclObj) TclStatus {
+	switch len(args) {
+	case 0:
+		var l []*TclObj
+		for _, m := range i.table().mounts {
+			if m.from != "" {
+				l = append(l, FromStr(m.point), FromStr(m.from))
+			}
+		}
+		return i.Return(fromList(l))
+	case 1:
+		point := zipfsPoint(args[0].AsString())
+		mounts := i.table().mounts
+		for ix := len(mounts) - 1; ix >= 0; ix-- {
+			if mounts[ix].point == point && mounts[ix].from != "" {
+				return i.Return(FromStr(mounts[ix].from))
+			}
+		}
+		return i.Return(kNil)
+	case 2:
+		from, point := args[0].AsString(), zipfsPoint(args[1].AsString())
+		f, e := i.FS().Open(from)
+		if e != nil {
+			return i.Fail(e)
+		}
+		data, e := io.ReadAll(f)
+		f.Close()
+		if e != nil {
+			return i.Fail(e)
+		}
+		v, e := ZipFS(bytes.NewReader(data), int64(len(data)))
+		if e != nil {
+			return i.FailStr("couldn't mount \"" + from + "\": " + e.Error())
+		}
+		i.mount(mount{point: point, fs: v, from: from})
+		return i.Return(FromStr(point))
+	}
+	return i.FailStr("wrong # args: should be \"zipfs mount ?zipfile? ?mountpoint?\"")
+}
+
+// zipfsPoint returns the mount point zipfs uses for p, putting it
+// under zipfsRoot if it's relative.
+func zipfsPoint(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = zipfsRoot + p
+	}
+	return cleanName(p)
+}
+
+func tclZipfsUnmount(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"zipfs unmount mountpoint\"")
+	}
+	if e := i.Unmount(zipfsPoint(args[0].AsString())); e != nil {
+		return i.Fail(e)
+	}
+	return i.Return(kNil)
+}
+
+var zipfsEn = ensembleSpec{
+	"mount":   tclZipfsMount,
+	"unmount": tclZipfsUnmount,
+	"root":    func(i *Interp) *TclObj { return FromStr(zipfsRoot) },
+}
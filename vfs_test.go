@@ -0,0 +1,90 @@
+package gotcl
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVFS(t *testing.T) {
+	base := fstest.MapFS{
+		"lib/main.tcl":   {Data: []byte("proc main {} { return base }\n")},
+		"lib/util.tcl":   {Data: []byte("set util base\n")},
+		"lib/.hidden":    {Data: []byte("")},
+		"data/lines.txt": {Data: []byte("first\nsecond\n")},
+	}
+	over := fstest.MapFS{
+		"main.tcl":  {Data: []byte("proc main {} { return over }\n")},
+		"extra.tcl": {Data: []byte("set extra over\n")},
+	}
+	i := NewInterp()
+	i.SetVFS(FromFS(base))
+	checkScripts(t, i, []scriptTest{
+		{"source /lib/main.tcl\nmain", "base"},
+		{"gets [open data/lines.txt]", "first"},
+		{"glob /lib/*", "/lib/main.tcl /lib/util.tcl"},
+		{"glob -directory /lib -tails *.tcl", "main.tcl util.tcl"},
+		{"glob */*.txt", "data/lines.txt"},
+		{"glob /nowhere/*", `no files matched glob pattern "/nowhere/*"`},
+		{"glob -nocomplain /nowhere/*", ""},
+		{"list [file isfile /lib] [file isdirectory /lib] [file exists /lib/none]", "0 1 0"},
+		{"file size /data/lines.txt", "13"},
+		{"file size /data/none", `could not read "/data/none": no such file or directory`},
+	})
+	i.Mount("/lib", FromFS(over))
+	checkScripts(t, i, []scriptTest{
+		{"source /lib/main.tcl\nmain", "over"},
+		{"source /lib/util.tcl\nsource /lib/extra.tcl\nlist $util $extra", "base over"},
+		{"glob -directory /lib -tails *.tcl", "extra.tcl main.tcl util.tcl"},
+		{"auto_mkindex /lib", "create /lib/tclIndex: read-only file system"},
+	})
+	if e := i.Unmount("/lib"); e != nil {
+		t.Fatal(e)
+	}
+	checkScripts(t, i, []scriptTest{
+		{"source /lib/main.tcl\nmain", "base"},
+		{"file exists /lib/extra.tcl", "0"},
+	})
+}
+
+func TestZipfs(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.zip")
+	f, e := os.Create(name)
+	if e != nil {
+		t.Fatal(e)
+	}
+	zw := zip.NewWriter(f)
+	for fname, body := range map[string]string{
+		"main.tcl":         "proc hello {} { return [greet] }\n",
+		"lib/tclIndex":     "set auto_index(greet) [list source \"$dir/greet.tcl\"]\n",
+		"lib/greet.tcl":    "proc greet {} { return hello }\n",
+		"lib/pkgIndex.tcl": "package ifneeded zipped 1.0 {package provide zipped 1.0}\n",
+	} {
+		w, e := zw.Create(fname)
+		if e != nil {
+			t.Fatal(e)
+		}
+		w.Write([]byte(body))
+	}
+	if e := zw.Close(); e != nil {
+		t.Fatal(e)
+	}
+	f.Close()
+
+	i := NewInterp()
+	i.SetVarRaw("zip", FromStr(name))
+	checkScripts(t, i, []scriptTest{
+		{"zipfs mount $zip app", "//zipfs:/app"},
+		{"expr {[zipfs mount] == [list //zipfs:/app $zip]}", "1"},
+		{"glob //zipfs:/app/*", "//zipfs:/app/lib //zipfs:/app/main.tcl"},
+		{"source //zipfs:/app/main.tcl\nset auto_path //zipfs:/app/lib\nhello", "hello"},
+		{"package require zipped", "1.0"},
+		{"zipfs unmount app\nfile exists //zipfs:/app/main.tcl", "0"},
+		{"zipfs unmount app", `no filesystem mounted at "//zipfs:/app"`},
+	})
+	if _, e := NewSafeInterp().EvalString("zipfs root"); e == nil {
+		t.Fatal("zipfs available in a safe interp")
+	}
+}
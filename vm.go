@@ -0,0 +1,404 @@
+package gotcl
+
+import (
+	"bytes"
+)
+
+type foreachIter struct {
+	lists [][]*TclObj
+	iter  int
+	n     int
+}
+
+// walkTree reports whether code must be interpreted from its command
+// tree rather than run compiled, so the debugger, profiler or coverage
+// see each command.
+func (i *Interp) walkTree() bool {
+	return i.debug != nil || i.prof != nil || i.cover != nil
+}
+
+// execute runs bc, leaving its result in i.retval.
+func (i *Interp) execute(bc *bytecode) TclStatus {
+	if i.walkTree() {
+		return i.evalCmds(bc.tree)
+	}
+	if bc.walk {
+		return bc.tree[0].eval(i)
+	}
+	base := len(i.stack)
+	rc := i.run(bc, base)
+	clear(i.stack[base:])
+	i.stack = i.stack[:base]
+	return rc
+}
+
+func (i *Interp) push(v *TclObj) {
+	if v == nil {
+		v = kNil
+	}
+	i.stack = append(i.stack, v)
+}
+
+func (i *Interp) pop() *TclObj {
+	v := i.stack[len(i.stack)-1]
+	i.stack = i.stack[:len(i.stack)-1]
+	return v
+}
+
+// popN removes the top n values, returning them in a new slice.
+func (i *Interp) popN(n int) []*TclObj {
+	top := len(i.stack) - n
+	vals := make([]*TclObj, n)
+	copy(vals, i.stack[top:])
+	i.stack = i.stack[:top]
+	return vals
+}
+
+func (i *Interp) loadLocal(slot int) (*TclObj, error) {
+	f := i.frame
+	if v := f.locals[slot].obj; v != nil {
+		return v, nil
+	}
+	return i.getVar(varRef{name: f.ltab.names[slot]})
+}
+
+func (i *Interp) storeLocal(slot int, val *TclObj) TclStatus {
+	f := i.frame
+	if v := &f.locals[slot]; v.link == nil && v.arrdata == nil {
+		v.obj = val
+		return kTclOK
+	}
+	return i.setVar(varRef{name: f.ltab.names[slot]}, val)
+}
+
+func (i *Interp) assign(bc *bytecode, t varTarget, val *TclObj) TclStatus {
+	if t.slot >= 0 {
+		return i.storeLocal(t.slot, val)
+	}
+	return i.setVar(bc.vrefs[t.vref], val)
+}
+
+// pushUnlessPopped pushes v, the result of the instruction before pc,
+// unless the instruction at pc would pop it straight off again, in
+// which case it returns the pc after that.
+func (i *Interp) pushUnlessPopped(code []instr, pc int, v *TclObj) int {
+	if pc < len(code) && code[pc].op == opPop {
+		return pc + 1
+	}
+	i.stack = append(i.stack, v)
+	return pc
+}
+
+// incrBy returns v, got with error e, plus n.
+func (i *Interp) incrBy(v *TclObj, e error, n int) (*TclObj, error) {
+	if e != nil {
+		return nil, e
+	}
+	iv, e := v.AsInt()
+	if e != nil {
+		return nil, e
+	}
+	return FromInt(iv + n), nil
+}
+
+func (i *Interp) incrValue(v *TclObj, e error, amount *TclObj) (*TclObj, error) {
+	if e != nil {
+		return nil, e
+	}
+	iv, e := v.AsInt()
+	if e != nil {
+		return nil, e
+	}
+	inc, e := amount.AsInt()
+	if e != nil {
+		return nil, e
+	}
+	return FromInt(iv + inc), nil
+}
+
+// pushOrBranch pushes r, the result of the instruction before pc,
+// unless the instruction at pc is a conditional jump, in which case
+// it returns where that would continue.
+func (i *Interp) pushOrBranch(code []instr, pc int, r *TclObj) int {
+	if pc < len(code) && (code[pc].op == opJumpFalse || code[pc].op == opJumpTrue) {
+		// A test, whose result is only needed to branch on.
+		if r.AsBool() == (code[pc].op == opJumpTrue) {
+			return int(code[pc].a)
+		}
+		return pc + 1
+	}
+	i.stack = append(i.stack, r)
+	return pc
+}
+
+func (i *Interp) run(bc *bytecode, base int) TclStatus {
+	var iters []foreachIter
+	code := bc.code
+	pc := 0
+	for pc < len(code) {
+		in := code[pc]
+		a := int(in.a)
+		pc++
+		rc := kTclOK
+		switch in.op {
+		case opPush:
+			i.stack = append(i.stack, bc.consts[a])
+		case opPop:
+			i.stack = i.stack[:len(i.stack)-1]
+		case opLoad:
+			v := i.frame.locals[a].obj
+			if v == nil {
+				// Not a plain local: leave it to loadLocal.
+				var e error
+				if v, e = i.loadLocal(a); e != nil {
+					return i.Fail(e)
+				}
+			}
+			i.stack = append(i.stack, v)
+		case opStore:
+			v := i.pop()
+			rc = i.storeLocal(a, v)
+			pc = i.pushUnlessPopped(code, pc, v)
+		case opLoadVar:
+			v, e := i.getVar(bc.vrefs[a])
+			if e != nil {
+				return i.Fail(e)
+			}
+			i.stack = append(i.stack, v)
+		case opStoreVar:
+			rc = i.setVar(bc.vrefs[a], i.stack[len(i.stack)-1])
+		case opIncr:
+			top := len(i.stack) - 1
+			v, e := i.loadLocal(a)
+			v, e = i.incrValue(v, e, i.stack[top])
+			if e != nil {
+				return i.Fail(e)
+			}
+			i.stack[top] = v
+			rc = i.storeLocal(a, v)
+		case opIncrImm:
+			v, e := i.loadLocal(a)
+			if v, e = i.incrBy(v, e, int(in.b)); e != nil {
+				return i.Fail(e)
+			}
+			rc = i.storeLocal(a, v)
+			pc = i.pushUnlessPopped(code, pc, v)
+		case opIncrVarImm:
+			vr := &bc.vrefs[a]
+			if vr.arrind == nil {
+				// A scalar needs looking up only once.
+				if ve, e := i.lookupVar(*vr); e == nil && ve.arrdata == nil {
+					v, e := i.incrBy(ve.obj, nil, int(in.b))
+					if e != nil {
+						return i.Fail(e)
+					}
+					ve.obj = v
+					pc = i.pushUnlessPopped(code, pc, v)
+					break
+				}
+			}
+			v, e := i.getVar(*vr)
+			if v, e = i.incrBy(v, e, int(in.b)); e != nil {
+				return i.Fail(e)
+			}
+			rc = i.setVar(*vr, v)
+			pc = i.pushUnlessPopped(code, pc, v)
+		case opIncrVar:
+			top := len(i.stack) - 1
+			vr := &bc.vrefs[a]
+			if vr.arrind == nil {
+				// A scalar needs looking up only once.
+				if ve, e := i.lookupVar(*vr); e == nil && ve.arrdata == nil {
+					v, e := i.incrValue(ve.obj, nil, i.stack[top])
+					if e != nil {
+						return i.Fail(e)
+					}
+					ve.obj, i.stack[top] = v, v
+					break
+				}
+			}
+			v, e := i.getVar(*vr)
+			v, e = i.incrValue(v, e, i.stack[top])
+			if e != nil {
+				return i.Fail(e)
+			}
+			i.stack[top] = v
+			rc = i.setVar(*vr, v)
+		case opConcat:
+			var buf bytes.Buffer
+			top := len(i.stack) - a
+			for _, v := range i.stack[top:] {
+				buf.WriteString(v.AsString())
+			}
+			i.stack = i.stack[:top]
+			i.stack = append(i.stack, FromStr(buf.String()))
+		case opInvoke:
+			c := &bc.calls[a]
+			if rc = i.invokeAt(c.site, i.popN(c.argc)); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opInvokeConst:
+			c := &bc.calls[a]
+			if rc = i.invokeAt(c.site, c.argv); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opEvalCmd:
+			if rc = bc.cmds[a].eval(i); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opEvalExpr:
+			if rc = bc.exprs[a].Eval(i); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opEvalTok:
+			if rc = bc.toks[a].Eval(i); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opBinop:
+			top := len(i.stack) - 1
+			r, e := bc.binops[a].action(i.stack[top-1], i.stack[top])
+			if e != nil {
+				return i.Fail(e)
+			}
+			i.stack = i.stack[:top-1]
+			pc = i.pushOrBranch(code, pc, r)
+		case opBinopLocals:
+			lo := &bc.localOps[a]
+			x, e := i.loadLocal(lo.x)
+			if e != nil {
+				return i.Fail(e)
+			}
+			y, e := i.loadLocal(lo.y)
+			if e != nil {
+				return i.Fail(e)
+			}
+			r, e := lo.op.action(x, y)
+			if e != nil {
+				return i.Fail(e)
+			}
+			pc = i.pushOrBranch(code, pc, r)
+		case opNot:
+			i.stack = append(i.stack, FromBool(!i.pop().AsBool()))
+		case opBitNot:
+			iv, e := i.pop().AsInt()
+			if e != nil {
+				return i.Fail(e)
+			}
+			i.stack = append(i.stack, FromInt(^iv))
+		case opToBool:
+			i.stack = append(i.stack, FromBool(i.pop().AsBool()))
+		case opFunc:
+			fc := bc.funcs[a]
+			if rc = fc.fn.fn(i, i.popN(fc.argc)); rc == kTclOK {
+				i.push(i.retval)
+			}
+		case opJump:
+			pc = a
+		case opJumpTrue:
+			if i.pop().AsBool() {
+				pc = a
+			}
+		case opJumpFalse:
+			if !i.pop().AsBool() {
+				pc = a
+			}
+		case opCmd:
+			i.cmdcount++
+			if i.limits != nil {
+				rc = i.checkLimits(true)
+			}
+		case opInline:
+			i.cmdcount++
+			if i.limits != nil {
+				rc = i.checkLimits(true)
+			}
+			if i.replaced != nil && rc == kTclOK {
+				if g := &bc.inlines[a]; i.replaced[g.name] {
+					if rc = bc.cmds[g.cmd].evalCounted(i); rc == kTclOK {
+						i.push(i.retval)
+						pc = g.skip
+					}
+				}
+			}
+		case opCheck:
+			if i.limits != nil {
+				rc = i.checkLimits(false)
+			}
+		case opForeachStart:
+			info := bc.foreachs[a]
+			it := foreachIter{lists: make([][]*TclObj, len(info.vars))}
+			for ix := len(info.vars) - 1; ix >= 0; ix-- {
+				l, e := i.pop().AsList()
+				if e != nil {
+					return i.Fail(e)
+				}
+				it.lists[ix] = l
+				if n := (len(l) + len(info.vars[ix]) - 1) / len(info.vars[ix]); n > it.n {
+					it.n = n
+				}
+			}
+			iters = append(iters, it)
+		case opForeachStep:
+			info := bc.foreachs[a]
+			it := &iters[len(iters)-1]
+			if it.iter >= it.n {
+				pc = info.end
+				break
+			}
+			for lx, vars := range info.vars {
+				l := it.lists[lx]
+				for vx, t := range vars {
+					val := kNil
+					if ix := it.iter*len(vars) + vx; ix < len(l) {
+						val = l[ix]
+					}
+					if rc = i.assign(bc, t, val); rc != kTclOK {
+						return rc
+					}
+				}
+			}
+			it.iter++
+		case opForeachEnd:
+			iters = iters[:len(iters)-1]
+		case opReturn:
+			i.retval = i.pop()
+			return kTclReturn
+		case opBreak:
+			rc = kTclBreak
+		case opContinue:
+			rc = kTclContinue
+		}
+		if rc == kTclOK {
+			continue
+		}
+		if rc != kTclBreak && rc != kTclContinue {
+			return rc
+		}
+		l := bc.loopAt(pc - 1)
+		if l == nil {
+			return rc
+		}
+		clear(i.stack[base+l.depth:])
+		i.stack = i.stack[:base+l.depth]
+		iters = iters[:l.iters]
+		if rc == kTclBreak {
+			pc = l.breakpc
+		} else {
+			pc = l.contpc
+		}
+	}
+	i.retval = i.pop()
+	return kTclOK
+}
+
+// loopAt returns the innermost loop whose body contains pc.
+func (bc *bytecode) loopAt(pc int) *loopRange {
+	var inner *loopRange
+	for ix := range bc.loops {
+		l := &bc.loops[ix]
+		if l.start <= pc && pc < l.end && (inner == nil || l.start > inner.start) {
+			inner = l
+		}
+	}
+	return inner
+}